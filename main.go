@@ -1,38 +1,161 @@
 package main
 
 import (
-	"crypto/tls"
-	"crypto/x509"
+	"context"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/audit"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/auth"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/config"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/health"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/logging"
 	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/mcpserver"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/metrics"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/ratelimit"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/session"
 	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tempodiscovery"
-	zaplogfmt "github.com/jsternberg/zap-logfmt"
-	oscrypto "github.com/openshift/library-go/pkg/crypto"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tlsconfig"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const serviceCACertPath = "/var/run/secrets/kubernetes.io/serviceaccount/service-ca.crt"
+const namespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// The tool catalog is loaded at startup, failed attempts are retried after this interval.
+const toolCatalogRetryInterval = 10 * time.Second
+
+const (
+	transportHTTP  = "http"
+	transportStdio = "stdio"
 )
 
 func main() {
-	config := zap.NewDevelopmentEncoderConfig()
-	logger := zap.New(zapcore.NewCore(
-		zaplogfmt.NewEncoder(config),
-		os.Stdout,
-		zapcore.DebugLevel,
-	))
-
-	var listenAddr string
-	var readOnly bool
-	flag.StringVar(&listenAddr, "listen", "0.0.0.0:8080", "The listen address of the MCP server.")
-	flag.BoolVar(&readOnly, "read-only", false, "Enable this to only expose readonly tools.")
+	cfg := config.Default()
+	var configFile string
+	var configReloadInterval time.Duration
+	var rateLimitsFile string
+	var auditConfigFile string
+	var transport string
+	flag.StringVar(&transport, "transport", transportHTTP, "Serve the MCP server over http, or over stdio for local use. The stdio transport uses the kubeconfig credentials for all requests.")
+	flag.StringVar(&configFile, "config", "", "Load the configuration from this YAML or JSON file. Settings in the file take precedence over flags. The file is reloaded on changes.")
+	flag.DurationVar(&configReloadInterval, "config-reload-interval", 10*time.Second, "How often to check the configuration file for changes.")
+	flag.StringVar(&cfg.Log.Level, "log-level", cfg.Log.Level, "The log level: debug, info, warn or error. The level can be changed at runtime at /loglevel on the metrics listener.")
+	flag.StringVar((*string)(&cfg.Log.Format), "log-format", string(cfg.Log.Format), "The log format: logfmt or json.")
+	flag.StringVar(&cfg.Listen, "listen", cfg.Listen, "The listen address of the MCP server.")
+	flag.StringVar(&cfg.Transports.StreamableHTTPPath, "streamable-http-path", cfg.Transports.StreamableHTTPPath, "Serve the streamable HTTP transport at this path. Set to an empty string to disable the transport.")
+	flag.StringVar(&cfg.Transports.SSEPath, "sse-path", "", "Serve the legacy HTTP+SSE transport at <path>/sse and <path>/message, for example /legacy. Disabled if empty.")
+	flag.BoolVar(&cfg.Sessions.Enabled, "stateful", false, "Enable stateful sessions of the streamable HTTP transport, which are required for server-initiated notifications.")
+	flag.DurationVar(&cfg.Sessions.TTL.Duration, "session-ttl", cfg.Sessions.TTL.Duration, "Stateful sessions expire after this duration without requests.")
+	flag.StringVar(&cfg.MetricsListen, "metrics-listen", cfg.MetricsListen, "The listen address of the Prometheus metrics endpoint. Set to an empty string to disable metrics.")
+	flag.BoolVar(&cfg.ReadOnly, "read-only", cfg.ReadOnly, "Enable this to only expose readonly tools.")
+	flag.StringVar(&cfg.Auth.APIKeysSecret, "api-keys-secret", "", "Accept API keys from this Secret (<namespace>/<name>).")
+	flag.DurationVar(&cfg.Auth.APIKeysRefreshInterval.Duration, "api-keys-refresh-interval", cfg.Auth.APIKeysRefreshInterval.Duration, "How often to reload the API keys Secret.")
+	flag.BoolVar(&cfg.Auth.TokenReview, "token-review", cfg.Auth.TokenReview, "Resolve the user and groups of bearer tokens with a TokenReview, which are matched by the tool policy. Requires the permission to create tokenreviews.")
+	flag.StringVar(&cfg.Auth.ServiceAccountTokenFile, "service-account-token-file", cfg.Auth.ServiceAccountTokenFile, "The token used for downstream requests authenticated with an API key or client certificate.")
+	flag.StringVar(&cfg.TLS.Cert, "tls-cert", "", "Serve TLS with this certificate file. The file is reloaded on changes.")
+	flag.StringVar(&cfg.TLS.Key, "tls-key", "", "Serve TLS with this private key file. The file is reloaded on changes.")
+	flag.StringVar(&cfg.TLS.ClientCA, "tls-client-ca", "", "Verify client certificates against this CA bundle. The certificate subject is mapped to an identity.")
+	flag.BoolVar(&cfg.TLS.RequireClientCert, "tls-require-client-cert", false, "Reject connections without a valid client certificate.")
+	flag.Var((*stringSlice)(&cfg.Downstream.CAFiles), "ca-file", "Trust this CA bundle for connections to Tempo. Can be specified multiple times. Defaults to the OpenShift service CA, if present.")
+	flag.BoolVar(&cfg.Downstream.SystemCA, "system-ca", cfg.Downstream.SystemCA, "Trust the system CAs for connections to Tempo.")
+	flag.StringVar(&cfg.Downstream.Cert, "downstream-tls-cert", "", "Present this client certificate to Tempo. The file is reloaded on changes.")
+	flag.StringVar(&cfg.Downstream.Key, "downstream-tls-key", "", "The private key of the client certificate presented to Tempo.")
+	flag.BoolVar(&cfg.Downstream.InsecureSkipVerify, "insecure-skip-verify", false, "Do not verify the certificates of Tempo instances. Only use this for development.")
+	flag.StringVar(&rateLimitsFile, "rate-limits", "", "Load rate limits and concurrency caps of tool calls from this YAML file.")
+	flag.StringVar(&auditConfigFile, "audit-config", "", "Write an audit log of every tool call to the sinks configured in this YAML file.")
+	flag.DurationVar(&cfg.Timeouts.Shutdown.Duration, "shutdown-timeout", cfg.Timeouts.Shutdown.Duration, "How long to wait for tool calls in progress when shutting down.")
+	flag.StringVar(&cfg.Tracing.OTLPEndpoint, "otlp-endpoint", "", "Export traces of the gateway to this OTLP/HTTP endpoint, for example http://tempo-simplest-distributor:4318.")
+	flag.Float64Var(&cfg.Tracing.SampleRatio, "trace-sample-ratio", cfg.Tracing.SampleRatio, "The ratio of new traces to sample, between 0 and 1.")
 	flag.Parse()
 
+	var err error
+	switch transport {
+	case transportHTTP:
+	case transportStdio:
+		// Several stdio servers can be started by the MCP clients of a user, therefore do not listen on a port by default
+		if !flagSet("metrics-listen") {
+			cfg.MetricsListen = ""
+		}
+	default:
+		exitOnError(fmt.Errorf("invalid transport %q, expected %s or %s", transport, transportHTTP, transportStdio))
+	}
+
+	if rateLimitsFile != "" {
+		cfg.RateLimits, err = loadRateLimits(rateLimitsFile)
+		exitOnError(err)
+	}
+	if auditConfigFile != "" {
+		cfg.Audit, err = loadAuditConfig(auditConfigFile)
+		exitOnError(err)
+	}
+
+	// The configuration file is applied on top of the flags
+	base := cfg
+	if configFile != "" {
+		loaded, err := config.Load(configFile, base)
+		exitOnError(err)
+		cfg = *loaded
+	} else {
+		exitOnError(cfg.Validate())
+	}
+
+	// Stdout is reserved for MCP messages with the stdio transport, logs and audit events are written to stderr instead
+	logOutput := os.Stdout
+	if transport == transportStdio {
+		logOutput = os.Stderr
+	}
+	logger, logLevel, err := logging.New(cfg.Log, logOutput)
+	exitOnError(err)
+
+	// Declared before the config watcher, which applies configuration changes to them
+	var server *mcpserver.MCPServer
+	var auditor *audit.Auditor
+
+	var configWatcher *config.Watcher
+	if configFile != "" {
+		configWatcher = config.NewWatcher(logger, configFile, base, func(old *config.Config, new *config.Config) {
+			server.Reconfigure(new.MCPServer())
+			_ = auditor.SetRedaction(new.Audit.Redaction)
+			if new.Log.Level != old.Log.Level {
+				_ = logLevel.UnmarshalText([]byte(new.Log.Level))
+			}
+			logger.Info("applied config changes", zap.String("path", configFile))
+
+			if changed := config.RestartRequired(old, new); len(changed) > 0 {
+				logger.Warn("some config changes are applied after a restart", zap.Strings("settings", changed))
+			}
+		})
+		err = configWatcher.Load()
+		if err != nil {
+			logger.Fatal("error", zap.Error(err))
+		}
+		cfg = *configWatcher.Current()
+	}
+
+	tracingConfig := cfg.TracingConfig()
+	tracingConfig.ServiceName = mcpserver.MCP_NAME
+	tracingConfig.ServiceVersion = mcpserver.MCP_VERSION
+	shutdownTracing, err := tracing.Setup(context.Background(), tracingConfig)
+	if err != nil {
+		logger.Fatal("error", zap.Error(err))
+	}
+	defer shutdownTracing(context.Background())
+
 	k8sConfig, errInCluster := rest.InClusterConfig()
 	if errInCluster != nil {
 		// Try local kubeconfig file
@@ -50,35 +173,323 @@ func main() {
 		logger.Fatal("error", zap.Error(err))
 	}
 
-	tlsConfig, err := buildTlsConfig("/var/run/secrets/kubernetes.io/serviceaccount/service-ca.crt")
+	clientTLSOpts := cfg.DownstreamTLSOptions()
+	if len(clientTLSOpts.CAFiles) == 0 {
+		if _, err := os.Stat(serviceCACertPath); err == nil {
+			clientTLSOpts.CAFiles = []string{serviceCACertPath}
+		} else {
+			logger.Info("OpenShift service CA not found, using system CAs only", zap.String("path", serviceCACertPath))
+		}
+	}
+
+	tlsProfile := tlsconfig.NewProfileWatcher(logger, k8sClient)
+	err = tlsProfile.Load(context.Background())
 	if err != nil {
-		logger.Fatal("error", zap.Error(err))
+		logger.Error("error loading TLS security profile, using default TLS settings", zap.Error(err))
 	}
+	go tlsProfile.Run(context.Background(), time.Minute)
 
-	logger.Info("Starting Tempo MCP gateway", zap.String("listen", listenAddr))
-	server := mcpserver.New(logger, k8sClient, tlsConfig, readOnly)
+	tlsClient, err := tlsconfig.NewClient(logger, k8sClient, clientTLSOpts, tlsProfile)
+	if err != nil {
+		logger.Fatal("error", zap.Error(err))
+	}
+	go func() {
+		err := tlsClient.Start(context.Background())
+		if err != nil {
+			logger.Fatal("error", zap.Error(err))
+		}
+	}()
 
-	err = http.ListenAndServe(listenAddr, server.HttpServer)
+	auditor, err = audit.New(logger, cfg.Audit, logOutput)
 	if err != nil {
 		logger.Fatal("error", zap.Error(err))
 	}
+	defer auditor.Close()
+
+	opts := mcpserver.Options{
+		ReadOnly:            cfg.ReadOnly,
+		ServiceAccountToken: auth.TokenFile(cfg.Auth.ServiceAccountTokenFile),
+		CertificateTenants:  cfg.TLS.ClientCertTenants,
+		Config:              cfg.MCPServer(),
+		Auditor:             auditor,
+		Transports:          cfg.MCPTransports(),
+	}
+
+	if cfg.Auth.APIKeysSecret != "" {
+		namespace, name, _ := strings.Cut(cfg.Auth.APIKeysSecret, "/")
+		apiKeys := auth.NewAPIKeyStore(logger, k8sClient, types.NamespacedName{Namespace: namespace, Name: name})
+		err = apiKeys.Load(context.Background())
+		if err != nil {
+			logger.Fatal("error", zap.Error(err))
+		}
+		go apiKeys.Run(context.Background(), cfg.Auth.APIKeysRefreshInterval.Duration)
+		opts.APIKeys = apiKeys
+	}
+
+	if cfg.Auth.TokenReview && transport == transportHTTP {
+		opts.TokenReviewer = auth.NewTokenReviewer(k8sClient)
+	}
+
+	if cfg.Sessions.Enabled && transport == transportHTTP {
+		opts.SessionTTL = cfg.Sessions.TTL.Duration
+		opts.SessionStore, err = newSessionStore(logger, k8sClient, cfg.Sessions)
+		if err != nil {
+			logger.Fatal("error", zap.Error(err))
+		}
+	}
+
+	server = mcpserver.New(logger, k8sClient, tlsClient, opts)
+	if opts.SessionStore != nil {
+		go server.RunSessions(context.Background(), time.Minute)
+	}
+	if configWatcher != nil {
+		go configWatcher.Run(context.Background(), configReloadInterval)
+	}
+
+	checker := health.NewChecker()
+	checker.Add("kubernetes", func(ctx context.Context) error {
+		return tempodiscovery.CheckCRDs(ctx, k8sClient)
+	})
+	checker.Add("caches", func(ctx context.Context) error {
+		if !tlsProfile.Synced() {
+			return fmt.Errorf("TLS security profile not loaded")
+		}
+		if opts.APIKeys != nil && !opts.APIKeys.Synced() {
+			return fmt.Errorf("API keys not loaded")
+		}
+		return nil
+	})
+	if transport == transportHTTP {
+		// The stdio transport loads the tool catalog with the kubeconfig credentials, not with a service account token
+		go server.LoadToolCatalog(context.Background(), toolCatalogRetryInterval)
+		checker.Add("toolCatalog", server.CheckToolCatalog)
+	}
+
+	if cfg.MetricsListen != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+			mux.Handle("/loglevel", logLevel)
+			mux.Handle("/healthz", health.LiveHandler())
+			mux.Handle("/readyz", checker.ReadyHandler())
+
+			logger.Info("Starting metrics server", zap.String("listen", cfg.MetricsListen))
+			err := http.ListenAndServe(cfg.MetricsListen, mux)
+			if err != nil {
+				logger.Fatal("error", zap.Error(err))
+			}
+		}()
+	}
+
+	if transport == transportStdio {
+		serveStdio(logger, server, k8sConfig, cfg.Timeouts.Shutdown.Duration)
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", health.LiveHandler())
+	mux.Handle("/readyz", checker.ReadyHandler())
+	mux.Handle("/", server.Handler())
+	// Cancelled after the tool calls were drained, to end the remaining notification streams
+	baseCtx, cancelBaseCtx := context.WithCancel(context.Background())
+	httpServer := &http.Server{
+		Addr:        cfg.Listen,
+		Handler:     mux,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+
+	if cfg.TLS.Cert != "" {
+		tlsServer, err := tlsconfig.NewServer(logger, cfg.ServerTLSOptions(), tlsProfile)
+		if err != nil {
+			logger.Fatal("error", zap.Error(err))
+		}
+		go func() {
+			err := tlsServer.Start(context.Background())
+			if err != nil {
+				logger.Fatal("error", zap.Error(err))
+			}
+		}()
+
+		httpServer.TLSConfig = tlsServer.TLSConfig()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		var err error
+		if httpServer.TLSConfig != nil {
+			logger.Info("Starting Tempo MCP gateway", zap.String("listen", cfg.Listen), zap.Bool("tls", true))
+			err = httpServer.ListenAndServeTLS("", "")
+		} else {
+			logger.Info("Starting Tempo MCP gateway", zap.String("listen", cfg.Listen), zap.Bool("tls", false))
+			err = httpServer.ListenAndServe()
+		}
+		serveErr <- err
+	}()
+
+	signalCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	select {
+	case err := <-serveErr:
+		logger.Fatal("error", zap.Error(err))
+	case <-signalCtx.Done():
+	}
+
+	// Stop accepting new tool calls and connections, and wait for the tool calls in progress
+	logger.Info("Shutting down Tempo MCP gateway", zap.Duration("timeout", cfg.Timeouts.Shutdown.Duration))
+	checker.Shutdown()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Shutdown.Duration)
+	defer cancel()
+
+	httpShutdown := make(chan error, 1)
+	go func() {
+		httpShutdown <- httpServer.Shutdown(shutdownCtx)
+	}()
+
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		logger.Warn("error draining tool calls", zap.Error(err))
+	}
+
+	cancelBaseCtx()
+	err = <-httpShutdown
+	if err != nil {
+		logger.Warn("error stopping HTTP server", zap.Error(err))
+		_ = httpServer.Close()
+	}
+	logger.Info("Stopped Tempo MCP gateway")
 }
 
-func buildTlsConfig(serviceCaCertPath string) (*tls.Config, error) {
-	serviceCertPEM, err := os.ReadFile(serviceCaCertPath)
+// newSessionStore creates the store of stateful sessions and starts the removal of expired sessions.
+func newSessionStore(logger *zap.Logger, k8sClient client.Client, sessions config.Sessions) (session.Store, error) {
+	switch sessions.Store {
+	case config.SessionStoreKubernetes:
+		namespace := sessions.Namespace
+		if namespace == "" {
+			data, err := os.ReadFile(namespacePath)
+			if err != nil {
+				return nil, fmt.Errorf("sessions.namespace is not set and the namespace of the gateway is unknown: %w", err)
+			}
+			namespace = strings.TrimSpace(string(data))
+		}
+		store := session.NewKubernetesStore(logger, k8sClient, namespace, sessions.TTL.Duration)
+		go store.Run(context.Background(), time.Minute)
+		logger.Info("Using Kubernetes session store", zap.String("namespace", namespace))
+		return store, nil
+	default:
+		store := session.NewMemoryStore(sessions.TTL.Duration)
+		go store.Run(context.Background(), time.Minute)
+		return store, nil
+	}
+}
+
+// serveStdio serves the MCP server on stdin and stdout until stdin is closed or a signal is received.
+func serveStdio(logger *zap.Logger, server *mcpserver.MCPServer, k8sConfig *rest.Config, shutdownTimeout time.Duration) {
+	tokens, err := auth.NewKubeconfigToken(k8sConfig)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read certificate file: tried '%s' and got %v", serviceCaCertPath, err)
+		logger.Fatal("error", zap.Error(err))
 	}
+	identity := &auth.Identity{
+		Name:   kubeconfigUser(),
+		Method: auth.MethodKubeconfig,
+	}
+
+	// The stdio server is stopped after the tool calls in progress were drained
+	listenCtx, cancelListen := context.WithCancel(context.Background())
+	defer cancelListen()
+	listenErr := make(chan error, 1)
+	go func() {
+		logger.Info("Starting Tempo MCP gateway", zap.String("transport", transportStdio), zap.String("identity", identity.Name))
+		listenErr <- server.ServeStdio(listenCtx, identity, tokens, os.Stdin, os.Stdout)
+	}()
 
-	serviceProxyRootCAs := x509.NewCertPool()
-	ok := serviceProxyRootCAs.AppendCertsFromPEM(serviceCertPEM)
-	if !ok {
-		return nil, fmt.Errorf("no CA found for Kubernetes services")
+	signalCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	select {
+	case err := <-listenErr:
+		if err != nil {
+			logger.Error("error serving stdio", zap.Error(err))
+		}
+	case <-signalCtx.Done():
 	}
 
-	serviceProxyTLSConfig := oscrypto.SecureTLSConfig(&tls.Config{
-		RootCAs: serviceProxyRootCAs,
+	logger.Info("Shutting down Tempo MCP gateway", zap.Duration("timeout", shutdownTimeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		logger.Warn("error draining tool calls", zap.Error(err))
+	}
+	logger.Info("Stopped Tempo MCP gateway")
+}
+
+// kubeconfigUser returns the user of the current kubeconfig context.
+func kubeconfigUser() string {
+	rawConfig, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
+	if err == nil {
+		if kubeContext, ok := rawConfig.Contexts[rawConfig.CurrentContext]; ok && kubeContext.AuthInfo != "" {
+			return kubeContext.AuthInfo
+		}
+	}
+	return "kubeconfig"
+}
+
+// flagSet returns true if the flag was set on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
 	})
+	return set
+}
+
+func loadRateLimits(path string) (ratelimit.Config, error) {
+	var config ratelimit.Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read rate limits: %w", err)
+	}
+
+	err = yaml.UnmarshalStrict(data, &config)
+	if err != nil {
+		return config, fmt.Errorf("failed to parse rate limits %s: %w", path, err)
+	}
+	return config, nil
+}
+
+func loadAuditConfig(path string) (audit.Config, error) {
+	var config audit.Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read audit config: %w", err)
+	}
+
+	err = yaml.UnmarshalStrict(data, &config)
+	if err != nil {
+		return config, fmt.Errorf("failed to parse audit config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// exitOnError exits if the configuration is invalid, before the logger is configured.
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// stringSlice is a flag which can be specified multiple times.
+type stringSlice []string
+
+func (s *stringSlice) String() string {
+	return strings.Join(*s, ",")
+}
 
-	return serviceProxyTLSConfig, nil
+func (s *stringSlice) Set(value string) error {
+	*s = append(*s, value)
+	return nil
 }
@@ -0,0 +1,199 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+const redacted = "[REDACTED]"
+
+// Event records a single tool invocation.
+type Event struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Identity   string    `json:"identity"`
+	AuthMethod string    `json:"authMethod"`
+	Groups     []string  `json:"groups,omitempty"`
+	Tool       string    `json:"tool"`
+	Instance   string    `json:"instance,omitempty"`
+	Tenant     string    `json:"tenant,omitempty"`
+	// All targets of tool calls which query more than one Tempo instance or tenant, e.g. diff-traces.
+	Targets    []Target       `json:"targets,omitempty"`
+	Arguments  map[string]any `json:"arguments,omitempty"`
+	ResultSize int            `json:"resultSize"`
+	DurationMs int64          `json:"durationMs"`
+	Outcome    string         `json:"outcome"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// Target is a Tempo instance and tenant queried by a tool call.
+type Target struct {
+	Instance string `json:"instance"`
+	Tenant   string `json:"tenant,omitempty"`
+}
+
+// Sink writes audit events to a destination.
+type Sink interface {
+	Name() string
+	Write(ctx context.Context, event Event) error
+	Close() error
+}
+
+type Config struct {
+	// Write audit events as JSON lines to stdout.
+	Stdout bool `json:"stdout,omitempty"`
+	// Write audit events as JSON lines to a file with size-based rotation.
+	File *FileConfig `json:"file,omitempty"`
+	// Send audit events to an HTTP webhook.
+	Webhook   *WebhookConfig  `json:"webhook,omitempty"`
+	Redaction RedactionConfig `json:"redaction,omitempty"`
+}
+
+type RedactionConfig struct {
+	// Replace the values of these tool arguments.
+	Arguments []string `json:"arguments,omitempty"`
+	// Replace matches of these regular expressions in string arguments.
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+// Auditor redacts audit events and writes them to all configured sinks.
+type Auditor struct {
+	logger   *zap.Logger
+	sinks    []Sink
+	redactor atomic.Pointer[redactor]
+}
+
+type redactor struct {
+	arguments map[string]bool
+	patterns  []*regexp.Regexp
+}
+
+// New creates an auditor with the configured sinks. The stdout sink writes to the given stream,
+// which is stderr if stdout is reserved for MCP messages.
+func New(logger *zap.Logger, config Config, stdout io.Writer) (*Auditor, error) {
+	a := &Auditor{
+		logger: logger,
+	}
+
+	err := a.SetRedaction(config.Redaction)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Stdout {
+		a.sinks = append(a.sinks, NewStdoutSink(stdout))
+	}
+	if config.File != nil {
+		sink, err := NewFileSink(*config.File)
+		if err != nil {
+			return nil, err
+		}
+		a.sinks = append(a.sinks, sink)
+	}
+	if config.Webhook != nil {
+		sink, err := NewWebhookSink(logger, *config.Webhook)
+		if err != nil {
+			return nil, err
+		}
+		a.sinks = append(a.sinks, sink)
+	}
+
+	return a, nil
+}
+
+// SetRedaction replaces the redaction rules of the audit events.
+func (a *Auditor) SetRedaction(config RedactionConfig) error {
+	r, err := newRedactor(config)
+	if err != nil {
+		return err
+	}
+	a.redactor.Store(r)
+	return nil
+}
+
+// Validate checks that all patterns are valid regular expressions.
+func (c RedactionConfig) Validate() error {
+	_, err := newRedactor(c)
+	return err
+}
+
+func newRedactor(config RedactionConfig) (*redactor, error) {
+	r := &redactor{
+		arguments: map[string]bool{},
+	}
+
+	for _, arg := range config.Arguments {
+		r.arguments[arg] = true
+	}
+	for _, pattern := range config.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid audit redaction pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// Enabled returns true if at least one sink is configured.
+func (a *Auditor) Enabled() bool {
+	return len(a.sinks) > 0
+}
+
+// Record redacts the arguments of the event and writes it to all sinks.
+// Errors are logged and counted, but do not fail the tool call.
+func (a *Auditor) Record(ctx context.Context, event Event) {
+	event.Arguments = a.redactor.Load().redact(event.Arguments)
+
+	for _, sink := range a.sinks {
+		err := sink.Write(ctx, event)
+		if err != nil {
+			metrics.AuditErrors.WithLabelValues(sink.Name()).Inc()
+			a.logger.Error("error writing audit event", zap.String("sink", sink.Name()), zap.Error(err))
+		}
+	}
+}
+
+func (a *Auditor) Close() error {
+	var errs []error
+	for _, sink := range a.sinks {
+		err := sink.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close audit sinks: %v", errs)
+	}
+	return nil
+}
+
+func (r *redactor) redact(args map[string]any) map[string]any {
+	if len(args) == 0 {
+		return args
+	}
+
+	redactedArgs := make(map[string]any, len(args))
+	for k, v := range args {
+		if r.arguments[k] {
+			redactedArgs[k] = redacted
+			continue
+		}
+
+		if str, ok := v.(string); ok {
+			for _, re := range r.patterns {
+				str = re.ReplaceAllString(str, redacted)
+			}
+			redactedArgs[k] = str
+		} else {
+			redactedArgs[k] = v
+		}
+	}
+	return redactedArgs
+}
@@ -0,0 +1,253 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/metrics"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// StdoutSink writes audit events as JSON lines to stdout, or to another stream which replaces stdout.
+type StdoutSink struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewStdoutSink(out io.Writer) *StdoutSink {
+	return &StdoutSink{out: out}
+}
+
+func (s *StdoutSink) Name() string {
+	return "stdout"
+}
+
+func (s *StdoutSink) Write(_ context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.out.Write(append(line, '\n'))
+	return err
+}
+
+func (s *StdoutSink) Close() error {
+	return nil
+}
+
+type FileConfig struct {
+	Path string `json:"path"`
+	// Rotate the file when it exceeds this size. Defaults to 100 MB.
+	MaxSizeMB int `json:"maxSizeMB,omitempty"`
+	// Keep this many rotated files (<path>.1 is the newest). Defaults to 5.
+	MaxBackups int `json:"maxBackups,omitempty"`
+}
+
+// FileSink writes audit events as JSON lines to a file, and rotates the file when it exceeds the maximum size.
+type FileSink struct {
+	config FileConfig
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewFileSink(config FileConfig) (*FileSink, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("audit file path must not be empty")
+	}
+	if config.MaxSizeMB <= 0 {
+		config.MaxSizeMB = 100
+	}
+	if config.MaxBackups <= 0 {
+		config.MaxBackups = 5
+	}
+
+	s := &FileSink{config: config}
+	err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) Name() string {
+	return "file"
+}
+
+func (s *FileSink) Write(_ context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size+int64(len(line)) > int64(s.config.MaxSizeMB)*1024*1024 {
+		err = s.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to stat audit file: %w", err)
+	}
+
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// rotate renames <path>.N to <path>.N+1, the current file to <path>.1, and opens a new file
+func (s *FileSink) rotate() error {
+	err := s.file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close audit file: %w", err)
+	}
+
+	_ = os.Remove(fmt.Sprintf("%s.%d", s.config.Path, s.config.MaxBackups))
+	for i := s.config.MaxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", s.config.Path, i), fmt.Sprintf("%s.%d", s.config.Path, i+1))
+	}
+
+	err = os.Rename(s.config.Path, s.config.Path+".1")
+	if err != nil {
+		return fmt.Errorf("failed to rotate audit file: %w", err)
+	}
+
+	return s.open()
+}
+
+type WebhookConfig struct {
+	URL string `json:"url"`
+	// Additional HTTP headers, for example for authentication.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Timeout of a single request. Defaults to 5s.
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+	// Number of events to buffer while the webhook is slow or unavailable. Defaults to 1000.
+	QueueSize int `json:"queueSize,omitempty"`
+}
+
+// WebhookSink posts audit events as JSON to an HTTP endpoint.
+// Events are sent asynchronously. If the queue is full, events are dropped and counted.
+type WebhookSink struct {
+	logger *zap.Logger
+	config WebhookConfig
+	client *http.Client
+	queue  chan Event
+	done   chan struct{}
+}
+
+func NewWebhookSink(logger *zap.Logger, config WebhookConfig) (*WebhookSink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("audit webhook URL must not be empty")
+	}
+	if config.Timeout.Duration <= 0 {
+		config.Timeout.Duration = 5 * time.Second
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 1000
+	}
+
+	s := &WebhookSink{
+		logger: logger,
+		config: config,
+		client: &http.Client{Timeout: config.Timeout.Duration},
+		queue:  make(chan Event, config.QueueSize),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (s *WebhookSink) Write(_ context.Context, event Event) error {
+	select {
+	case s.queue <- event:
+		return nil
+	default:
+		return fmt.Errorf("audit webhook queue is full, dropping event")
+	}
+}
+
+// Close sends the queued events and stops the sink.
+func (s *WebhookSink) Close() error {
+	close(s.queue)
+	<-s.done
+	return nil
+}
+
+func (s *WebhookSink) run() {
+	defer close(s.done)
+
+	for event := range s.queue {
+		err := s.send(event)
+		if err != nil {
+			metrics.AuditErrors.WithLabelValues(s.Name()).Inc()
+			s.logger.Error("error sending audit event to webhook", zap.Error(err))
+		}
+	}
+}
+
+func (s *WebhookSink) send(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
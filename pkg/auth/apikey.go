@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// APIKeysSecretKey is the key in the Secret data which holds the API key configuration.
+const APIKeysSecretKey = "keys.yaml"
+
+// AllTenants grants an API key or a client certificate access to all tenants.
+const AllTenants = "*"
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	ErrExpiredAPIKey = errors.New("API key expired")
+)
+
+type APIKeyConfig struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// APIKey maps a static API key to a fixed identity.
+// Only the SHA-256 hash of the key is stored. Multiple keys can map to the same identity, which allows
+// rotating keys without downtime: add the new key, update the clients, then remove the old key.
+type APIKey struct {
+	// Name identifies the key in logs, for example "ci-bot-2026-10".
+	Name string `json:"name"`
+	// SHA256 is the hex-encoded SHA-256 hash of the API key, for example the output of `echo -n $KEY | sha256sum`.
+	SHA256   string   `json:"sha256"`
+	Identity string   `json:"identity"`
+	Groups   []string `json:"groups,omitempty"`
+	// Tenants is the list of tenants this key may query. Use "*" to allow all tenants.
+	Tenants   []string   `json:"tenants"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	hash []byte
+}
+
+// APIKeyStore authenticates API keys loaded from a Kubernetes Secret.
+type APIKeyStore struct {
+	logger    *zap.Logger
+	k8sClient client.Client
+	secret    types.NamespacedName
+
+	mu     sync.RWMutex
+	keys   []APIKey
+	synced atomic.Bool
+}
+
+func NewAPIKeyStore(logger *zap.Logger, k8sClient client.Client, secret types.NamespacedName) *APIKeyStore {
+	return &APIKeyStore{
+		logger:    logger,
+		k8sClient: k8sClient,
+		secret:    secret,
+	}
+}
+
+// Load reads the API keys from the Secret.
+// Invalid entries are skipped. If the Secret cannot be read, the previously loaded keys stay active.
+func (s *APIKeyStore) Load(ctx context.Context) error {
+	var secret corev1.Secret
+	err := s.k8sClient.Get(ctx, s.secret, &secret)
+	if err != nil {
+		return fmt.Errorf("failed to get API keys secret %s: %w", s.secret, err)
+	}
+
+	data, ok := secret.Data[APIKeysSecretKey]
+	if !ok {
+		return fmt.Errorf("API keys secret %s does not contain the key %s", s.secret, APIKeysSecretKey)
+	}
+
+	var config APIKeyConfig
+	err = yaml.UnmarshalStrict(data, &config)
+	if err != nil {
+		return fmt.Errorf("failed to parse API keys secret %s: %w", s.secret, err)
+	}
+
+	keys := []APIKey{}
+	for _, key := range config.Keys {
+		err := key.validate()
+		if err != nil {
+			s.logger.Error("skipping invalid API key", zap.String("key", key.Name), zap.Error(err))
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+	s.synced.Store(true)
+
+	s.logger.Info("loaded API keys", zap.String("secret", s.secret.String()), zap.Int("keys", len(keys)))
+	return nil
+}
+
+// Synced returns true if the API keys were loaded at least once.
+func (s *APIKeyStore) Synced() bool {
+	return s.synced.Load()
+}
+
+// Run reloads the API keys periodically until the context is cancelled.
+func (s *APIKeyStore) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.Load(ctx)
+			if err != nil {
+				s.logger.Error("error reloading API keys", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Authenticate returns the identity of an API key.
+func (s *APIKeyStore) Authenticate(apiKey string) (*Identity, error) {
+	hash := sha256.Sum256([]byte(apiKey))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.keys {
+		if subtle.ConstantTimeCompare(hash[:], key.hash) != 1 {
+			continue
+		}
+
+		if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+			s.logger.Info("rejected expired API key", zap.String("key", key.Name), zap.String("identity", key.Identity))
+			return nil, ErrExpiredAPIKey
+		}
+
+		identity := &Identity{
+			Name:   key.Identity,
+			Groups: key.Groups,
+			Method: MethodAPIKey,
+		}
+		if !key.allTenants() {
+			identity.AllowedTenants = key.Tenants
+		}
+		return identity, nil
+	}
+
+	return nil, ErrInvalidAPIKey
+}
+
+func (k *APIKey) validate() error {
+	if k.Name == "" {
+		return fmt.Errorf("name must not be empty")
+	}
+	if k.Identity == "" {
+		return fmt.Errorf("identity must not be empty")
+	}
+	if len(k.Tenants) == 0 {
+		return fmt.Errorf("tenants must not be empty, use %q to allow all tenants", AllTenants)
+	}
+
+	hash, err := hex.DecodeString(k.SHA256)
+	if err != nil || len(hash) != sha256.Size {
+		return fmt.Errorf("sha256 must be a hex-encoded SHA-256 hash")
+	}
+	k.hash = hash
+	return nil
+}
+
+func (k *APIKey) allTenants() bool {
+	return slices.Contains(k.Tenants, AllTenants)
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"slices"
+)
+
+type contextKey string
+
+const identityKey contextKey = "identity"
+
+type MethodType string
+
+const (
+	MethodBearerToken MethodType = "bearer"
+	MethodAPIKey      MethodType = "apikey"
+	MethodClientCert  MethodType = "mtls"
+	MethodKubeconfig  MethodType = "kubeconfig"
+)
+
+// Identity is the authenticated caller of the gateway.
+type Identity struct {
+	Name   string     `json:"name"`
+	Groups []string   `json:"groups,omitempty"`
+	Method MethodType `json:"method"`
+	// AllowedTenants restricts the tenants this identity may query.
+	// A nil list does not restrict the tenants, access is decided by the Tempo gateway alone.
+	AllowedTenants []string `json:"allowedTenants,omitempty"`
+}
+
+func (i *Identity) TenantAllowed(tenant string) bool {
+	if i.AllowedTenants == nil {
+		return true
+	}
+	return slices.Contains(i.AllowedTenants, tenant)
+}
+
+// IdentityFromCertificate maps the subject of a verified client certificate to an identity,
+// following the Kubernetes convention: the common name is the user name and the organizations are the groups.
+func IdentityFromCertificate(cert *x509.Certificate) *Identity {
+	return &Identity{
+		Name:   cert.Subject.CommonName,
+		Groups: cert.Subject.Organization,
+		Method: MethodClientCert,
+	}
+}
+
+// CertificateTenants maps the identities of client certificates to the tenants they may query
+// when no bearer token is sent and the service account token of the gateway is used downstream.
+type CertificateTenants struct {
+	// Tenants by common name of the certificate subject. Use "*" to allow all tenants.
+	Users map[string][]string `json:"users,omitempty"`
+	// Tenants by organization of the certificate subject. Use "*" to allow all tenants.
+	Groups map[string][]string `json:"groups,omitempty"`
+}
+
+// AllowedTenants returns the union of the tenants of the user and the groups of an identity.
+// It returns false if the identity is not mapped to any tenant.
+// A nil list of tenants allows all tenants.
+func (c CertificateTenants) AllowedTenants(identity *Identity) ([]string, bool) {
+	tenants := slices.Clone(c.Users[identity.Name])
+	for _, group := range identity.Groups {
+		tenants = append(tenants, c.Groups[group]...)
+	}
+
+	if len(tenants) == 0 {
+		return nil, false
+	}
+	if slices.Contains(tenants, AllTenants) {
+		return nil, true
+	}
+	slices.Sort(tenants)
+	return slices.Compact(tenants), true
+}
+
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey, identity)
+}
+
+// IdentityFromContext returns the identity of the caller, or nil if the caller is not known.
+func IdentityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey).(*Identity)
+	return identity
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport"
+)
+
+// KubeconfigToken returns the bearer token of the kubeconfig credentials.
+// Static tokens, token files, exec plugins and auth providers are supported. Expired tokens of exec plugins are refreshed by client-go.
+type KubeconfigToken struct {
+	roundTripper http.RoundTripper
+}
+
+func NewKubeconfigToken(config *rest.Config) (*KubeconfigToken, error) {
+	transportConfig, err := config.TransportConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig credentials: %w", err)
+	}
+
+	// The authentication wrappers of client-go set the Authorization header of a request, which is then captured
+	roundTripper, err := transport.HTTPWrappersForConfig(transportConfig, captureAuthorization{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig credentials: %w", err)
+	}
+
+	return &KubeconfigToken{roundTripper: roundTripper}, nil
+}
+
+// Token returns the current bearer token, or an empty string if the kubeconfig credentials do not use a bearer token,
+// for example client certificates.
+func (k *KubeconfigToken) Token() (string, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://kubeconfig.invalid/", nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := k.roundTripper.RoundTrip(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get token from kubeconfig credentials: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return strings.TrimPrefix(resp.Header.Get("Authorization"), "Bearer "), nil
+}
+
+// captureAuthorization returns the Authorization header of the request in the response, without sending the request.
+type captureAuthorization struct{}
+
+func (captureAuthorization) RoundTrip(req *http.Request) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("Authorization", req.Header.Get("Authorization"))
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     header,
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
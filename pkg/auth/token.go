@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TokenSource returns the token used for downstream requests.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// TokenFile is the path of the service account token of the gateway.
+// The gateway token is used for downstream requests of callers which do not present a bearer token,
+// for example callers authenticated with an API key or a client certificate.
+type TokenFile string
+
+// Token reads the token file. The file is read on every call, because projected service account tokens are rotated by the kubelet.
+func (f TokenFile) Token() (string, error) {
+	token, err := os.ReadFile(string(f))
+	if err != nil {
+		return "", fmt.Errorf("failed to read service account token: %w", err)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
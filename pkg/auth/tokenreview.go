@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The results of token reviews are cached for this duration.
+const tokenReviewTTL = time.Minute
+
+// The cache is cleared if it holds more entries, for example if many different tokens are sent.
+const tokenReviewMaxEntries = 10000
+
+// ErrTokenReviewFailed is returned if the Kubernetes API did not review a token, for example if the gateway may not create TokenReviews.
+var ErrTokenReviewFailed = errors.New("the identity of the bearer token could not be resolved with a TokenReview")
+
+// TokenReviewer resolves the user name and groups of Kubernetes bearer tokens with a TokenReview.
+// The results are cached, therefore the Kubernetes API is not called on every request.
+type TokenReviewer struct {
+	k8sClient client.Client
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]tokenReviewResult
+}
+
+type tokenReviewResult struct {
+	identity  *Identity
+	expiresAt time.Time
+}
+
+func NewTokenReviewer(k8sClient client.Client) *TokenReviewer {
+	return &TokenReviewer{
+		k8sClient: k8sClient,
+		cache:     map[[sha256.Size]byte]tokenReviewResult{},
+	}
+}
+
+// Identity returns the identity of a bearer token, or nil if the Kubernetes API does not authenticate the token,
+// for example an OIDC token which is only accepted by the Tempo gateway.
+func (r *TokenReviewer) Identity(ctx context.Context, token string) (*Identity, error) {
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	r.mu.Lock()
+	cached, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.identity, nil
+	}
+
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}
+	err := r.k8sClient.Create(ctx, review)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenReviewFailed, err)
+	}
+
+	var identity *Identity
+	if review.Status.Authenticated {
+		identity = &Identity{
+			Name:   review.Status.User.Username,
+			Groups: review.Status.User.Groups,
+			Method: MethodBearerToken,
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.cache) >= tokenReviewMaxEntries {
+		clear(r.cache)
+	}
+	r.cache[key] = tokenReviewResult{identity: identity, expiresAt: now.Add(tokenReviewTTL)}
+	return identity, nil
+}
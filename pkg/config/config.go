@@ -0,0 +1,494 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/audit"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/auth"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/guardrails"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/logging"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/mcpserver"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/policy"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/ratelimit"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/redaction"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tempodiscovery"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tlsconfig"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/traceql"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tracing"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/truncation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the configuration file of the gateway.
+// The discovery, timeouts (except shutdown), tools, rateLimits, traceql, guardrails, redaction, truncation, sessions.instanceCacheTTL, audit.redaction and log.level settings are applied at runtime,
+// all other settings require a restart.
+type Config struct {
+	Listen     string     `json:"listen,omitempty"`
+	Transports Transports `json:"transports,omitempty"`
+	Sessions   Sessions   `json:"sessions,omitempty"`
+	// The listen address of the metrics and health endpoints. Disabled if empty.
+	MetricsListen string `json:"metricsListen,omitempty"`
+	// Only expose readonly tools.
+	ReadOnly   bool              `json:"readOnly,omitempty"`
+	TLS        ServerTLS         `json:"tls,omitempty"`
+	Auth       Auth              `json:"auth,omitempty"`
+	Downstream DownstreamTLS     `json:"downstreamTLS,omitempty"`
+	Discovery  Discovery         `json:"discovery,omitempty"`
+	Timeouts   Timeouts          `json:"timeouts,omitempty"`
+	Tools      policy.Config     `json:"tools,omitempty"`
+	RateLimits ratelimit.Config  `json:"rateLimits,omitempty"`
+	TraceQL    traceql.Config    `json:"traceql,omitempty"`
+	Guardrails guardrails.Config `json:"guardrails,omitempty"`
+	Redaction  redaction.Config  `json:"redaction,omitempty"`
+	Truncation truncation.Config `json:"truncation,omitempty"`
+	Audit      audit.Config      `json:"audit,omitempty"`
+	Tracing    Tracing           `json:"tracing,omitempty"`
+	Log        logging.Config    `json:"log,omitempty"`
+}
+
+// Transports configures the paths of the MCP transports on the listen address. An empty path disables a transport.
+type Transports struct {
+	// The path of the streamable HTTP transport. The path / matches all paths which are not used by another transport.
+	StreamableHTTPPath string `json:"streamableHTTPPath,omitempty"`
+	// The base path of the legacy HTTP+SSE transport. The event stream is served at <path>/sse and the messages at <path>/message.
+	SSEPath string `json:"ssePath,omitempty"`
+}
+
+// Sessions configures stateful sessions of the streamable HTTP transport.
+type Sessions struct {
+	// Enable stateful sessions, which are required for server-initiated notifications.
+	Enabled bool `json:"enabled,omitempty"`
+	// Sessions expire after this duration without requests.
+	TTL metav1.Duration `json:"ttl,omitempty"`
+	// How long the Tempo instances accessible to a session are cached. Not cached if zero.
+	InstanceCacheTTL metav1.Duration `json:"instanceCacheTTL,omitempty"`
+	// memory or kubernetes. The kubernetes store keeps the sessions in Secrets, which are shared by all replicas.
+	Store SessionStoreType `json:"store,omitempty"`
+	// The namespace of the Secrets of the kubernetes store. Defaults to the namespace of the gateway.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type SessionStoreType string
+
+const (
+	SessionStoreMemory     SessionStoreType = "memory"
+	SessionStoreKubernetes SessionStoreType = "kubernetes"
+)
+
+type ServerTLS struct {
+	Cert string `json:"cert,omitempty"`
+	Key  string `json:"key,omitempty"`
+	// Verify client certificates against this CA bundle.
+	ClientCA          string `json:"clientCA,omitempty"`
+	RequireClientCert bool   `json:"requireClientCert,omitempty"`
+	// The tenants of client certificates used without a bearer token, which query Tempo with the service account token of the gateway.
+	ClientCertTenants auth.CertificateTenants `json:"clientCertTenants,omitempty"`
+}
+
+type Auth struct {
+	// Accept API keys from this Secret (<namespace>/<name>).
+	APIKeysSecret          string          `json:"apiKeysSecret,omitempty"`
+	APIKeysRefreshInterval metav1.Duration `json:"apiKeysRefreshInterval,omitempty"`
+	// The token used for downstream requests of callers authenticated with an API key or a client certificate.
+	ServiceAccountTokenFile string `json:"serviceAccountTokenFile,omitempty"`
+	// Resolve the user and groups of bearer tokens with a TokenReview, which are matched by the identities and groups of the tool policy.
+	// Requires the permission to create tokenreviews.
+	TokenReview bool `json:"tokenReview,omitempty"`
+}
+
+type DownstreamTLS struct {
+	CAFiles            []string `json:"caFiles,omitempty"`
+	SystemCA           bool     `json:"systemCA,omitempty"`
+	Cert               string   `json:"cert,omitempty"`
+	Key                string   `json:"key,omitempty"`
+	InsecureSkipVerify bool     `json:"insecureSkipVerify,omitempty"`
+}
+
+type Discovery struct {
+	// Only discover Tempo instances in these namespaces. All namespaces are searched if empty.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Overrides of individual instances, by <namespace>/<name>.
+	Instances map[string]Instance `json:"instances,omitempty"`
+}
+
+type Instance struct {
+	// Hide the instance from all callers.
+	Disabled bool `json:"disabled,omitempty"`
+	// Verify the endpoints of the instance with a CA bundle from a ConfigMap in the namespace of the instance.
+	CABundle *CABundle `json:"caBundle,omitempty"`
+}
+
+type CABundle struct {
+	ConfigMap string `json:"configMap"`
+	// Defaults to ca.crt.
+	Key string `json:"key,omitempty"`
+}
+
+type Timeouts struct {
+	Discovery metav1.Duration `json:"discovery,omitempty"`
+	ToolCall  metav1.Duration `json:"toolCall,omitempty"`
+	Shutdown  metav1.Duration `json:"shutdown,omitempty"`
+}
+
+type Tracing struct {
+	OTLPEndpoint string  `json:"otlpEndpoint,omitempty"`
+	SampleRatio  float64 `json:"sampleRatio,omitempty"`
+}
+
+// Default returns the configuration which is used if neither flags nor a configuration file are set.
+func Default() Config {
+	return Config{
+		Listen:        "0.0.0.0:8080",
+		MetricsListen: "0.0.0.0:9090",
+		Transports: Transports{
+			StreamableHTTPPath: "/",
+		},
+		Sessions: Sessions{
+			TTL:              metav1.Duration{Duration: 30 * time.Minute},
+			InstanceCacheTTL: metav1.Duration{Duration: time.Minute},
+			Store:            SessionStoreMemory,
+		},
+		Auth: Auth{
+			APIKeysRefreshInterval:  metav1.Duration{Duration: time.Minute},
+			ServiceAccountTokenFile: "/var/run/secrets/kubernetes.io/serviceaccount/token",
+		},
+		Downstream: DownstreamTLS{
+			SystemCA: true,
+		},
+		Timeouts: Timeouts{
+			Discovery: metav1.Duration{Duration: 30 * time.Second},
+			ToolCall:  metav1.Duration{Duration: 5 * time.Minute},
+			Shutdown:  metav1.Duration{Duration: 30 * time.Second},
+		},
+		Tracing: Tracing{
+			SampleRatio: 1,
+		},
+		Log: logging.Config{
+			Level:  "info",
+			Format: logging.FormatLogfmt,
+		},
+	}
+}
+
+// Load reads the configuration file and applies it on top of the base configuration, which is usually set from flags.
+func Load(path string, base Config) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	return Parse(path, data, base)
+}
+
+// Parse parses a YAML or JSON configuration and applies it on top of the base configuration.
+func Parse(path string, data []byte, base Config) (*Config, error) {
+	config, err := base.deepCopy()
+	if err != nil {
+		return nil, err
+	}
+
+	err = yaml.UnmarshalStrict(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Validate checks the configuration and returns all errors, prefixed with the path of the invalid field.
+func (c *Config) Validate() error {
+	var errs []error
+	fieldErr := func(field string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		fieldErr("listen", "invalid address %q: %v", c.Listen, err)
+	}
+	if c.MetricsListen != "" {
+		if _, _, err := net.SplitHostPort(c.MetricsListen); err != nil {
+			fieldErr("metricsListen", "invalid address %q: %v", c.MetricsListen, err)
+		}
+	}
+
+	if c.Transports.StreamableHTTPPath == "" && c.Transports.SSEPath == "" {
+		fieldErr("transports", "at least one transport must be enabled")
+	}
+	if c.Transports.StreamableHTTPPath != "" && !strings.HasPrefix(c.Transports.StreamableHTTPPath, "/") {
+		fieldErr("transports.streamableHTTPPath", "must start with /")
+	}
+	if c.Transports.SSEPath != "" {
+		ssePath := strings.TrimSuffix(c.Transports.SSEPath, "/")
+		if !strings.HasPrefix(c.Transports.SSEPath, "/") {
+			fieldErr("transports.ssePath", "must start with /")
+		} else if c.Transports.StreamableHTTPPath == ssePath+"/sse" || c.Transports.StreamableHTTPPath == ssePath+"/message" {
+			fieldErr("transports.ssePath", "conflicts with transports.streamableHTTPPath")
+		}
+	}
+
+	if c.Sessions.TTL.Duration <= 0 {
+		fieldErr("sessions.ttl", "must be positive")
+	}
+	if c.Sessions.InstanceCacheTTL.Duration < 0 {
+		fieldErr("sessions.instanceCacheTTL", "must not be negative")
+	}
+	switch c.Sessions.Store {
+	case SessionStoreMemory, SessionStoreKubernetes:
+	default:
+		fieldErr("sessions.store", "invalid store %q, expected %s or %s", c.Sessions.Store, SessionStoreMemory, SessionStoreKubernetes)
+	}
+
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		fieldErr("tls", "cert and key must be set together")
+	}
+	if c.TLS.ClientCA != "" && c.TLS.Cert == "" {
+		fieldErr("tls.clientCA", "requires tls.cert and tls.key")
+	}
+	if c.TLS.RequireClientCert && c.TLS.ClientCA == "" {
+		fieldErr("tls.requireClientCert", "requires tls.clientCA")
+	}
+	validateTenants := func(field string, tenants map[string][]string) {
+		for _, name := range slices.Sorted(maps.Keys(tenants)) {
+			if len(tenants[name]) == 0 {
+				fieldErr(fmt.Sprintf("%s[%s]", field, name), "must not be empty, use %q to allow all tenants", auth.AllTenants)
+			}
+		}
+	}
+	validateTenants("tls.clientCertTenants.users", c.TLS.ClientCertTenants.Users)
+	validateTenants("tls.clientCertTenants.groups", c.TLS.ClientCertTenants.Groups)
+
+	if c.Auth.APIKeysSecret != "" {
+		if _, _, err := splitNamespacedName(c.Auth.APIKeysSecret); err != nil {
+			fieldErr("auth.apiKeysSecret", "%v", err)
+		}
+	}
+	if c.Auth.APIKeysRefreshInterval.Duration <= 0 {
+		fieldErr("auth.apiKeysRefreshInterval", "must be positive")
+	}
+
+	if (c.Downstream.Cert == "") != (c.Downstream.Key == "") {
+		fieldErr("downstreamTLS", "cert and key must be set together")
+	}
+
+	for i, namespace := range c.Discovery.Namespaces {
+		if namespace == "" {
+			fieldErr(fmt.Sprintf("discovery.namespaces[%d]", i), "must not be empty")
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Discovery.Instances)) {
+		instance := c.Discovery.Instances[name]
+		if _, _, err := splitNamespacedName(name); err != nil {
+			fieldErr(fmt.Sprintf("discovery.instances[%s]", name), "%v", err)
+		}
+		if instance.CABundle != nil && instance.CABundle.ConfigMap == "" {
+			fieldErr(fmt.Sprintf("discovery.instances[%s].caBundle.configMap", name), "must not be empty")
+		}
+	}
+
+	if c.Timeouts.Discovery.Duration < 0 {
+		fieldErr("timeouts.discovery", "must not be negative")
+	}
+	if c.Timeouts.ToolCall.Duration < 0 {
+		fieldErr("timeouts.toolCall", "must not be negative")
+	}
+	if c.Timeouts.Shutdown.Duration < 0 {
+		fieldErr("timeouts.shutdown", "must not be negative")
+	}
+
+	if err := c.Tools.Validate(); err != nil {
+		fieldErr("tools", "%v", err)
+	}
+
+	validateLimit := func(field string, limit ratelimit.Limit) {
+		if limit.RPS < 0 || limit.Burst < 0 || limit.MaxInFlight < 0 {
+			fieldErr(field, "limits must not be negative")
+		}
+	}
+	validateLimit("rateLimits.identity", c.RateLimits.Identity)
+	validateLimit("rateLimits.tenant", c.RateLimits.Tenant)
+	validateLimit("rateLimits.instance", c.RateLimits.Instance)
+	for _, name := range slices.Sorted(maps.Keys(c.RateLimits.Overrides.Identities)) {
+		limit := c.RateLimits.Overrides.Identities[name]
+		validateLimit(fmt.Sprintf("rateLimits.overrides.identities[%s]", name), limit)
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.RateLimits.Overrides.Tenants)) {
+		limit := c.RateLimits.Overrides.Tenants[name]
+		validateLimit(fmt.Sprintf("rateLimits.overrides.tenants[%s]", name), limit)
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.RateLimits.Overrides.Instances)) {
+		limit := c.RateLimits.Overrides.Instances[name]
+		validateLimit(fmt.Sprintf("rateLimits.overrides.instances[%s]", name), limit)
+	}
+
+	if err := c.TraceQL.Validate(); err != nil {
+		fieldErr("traceql", "%v", err)
+	}
+	if err := c.Guardrails.Validate(); err != nil {
+		fieldErr("guardrails", "%v", err)
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Guardrails.Overrides.Instances)) {
+		if _, _, err := splitNamespacedName(name); err != nil {
+			fieldErr(fmt.Sprintf("guardrails.overrides.instances[%s]", name), "%v", err)
+		}
+	}
+
+	if err := c.Redaction.Validate(); err != nil {
+		fieldErr("redaction", "%v", err)
+	}
+
+	if err := c.Truncation.Validate(); err != nil {
+		fieldErr("truncation", "%v", err)
+	}
+
+	if c.Audit.File != nil && c.Audit.File.Path == "" {
+		fieldErr("audit.file.path", "must not be empty")
+	}
+	if c.Audit.Webhook != nil && c.Audit.Webhook.URL == "" {
+		fieldErr("audit.webhook.url", "must not be empty")
+	}
+	if err := c.Audit.Redaction.Validate(); err != nil {
+		fieldErr("audit.redaction.patterns", "%v", err)
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fieldErr("tracing.sampleRatio", "must be between 0 and 1")
+	}
+
+	if err := c.Log.Validate(); err != nil {
+		fieldErr("log", "%v", err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// MCPServer returns the settings of the MCP server which can be changed at runtime.
+func (c *Config) MCPServer() mcpserver.Config {
+	discovery := tempodiscovery.Config{
+		Namespaces: c.Discovery.Namespaces,
+		Instances:  map[string]tempodiscovery.InstanceOverride{},
+	}
+	for name, instance := range c.Discovery.Instances {
+		override := tempodiscovery.InstanceOverride{Disabled: instance.Disabled}
+		if instance.CABundle != nil {
+			namespace, _, _ := splitNamespacedName(name)
+			override.CABundle = &tlsconfig.ConfigMapRef{
+				Namespace: namespace,
+				Name:      instance.CABundle.ConfigMap,
+				Key:       instance.CABundle.Key,
+			}
+		}
+		discovery.Instances[name] = override
+	}
+
+	return mcpserver.Config{
+		Discovery:        discovery,
+		DiscoveryTimeout: c.Timeouts.Discovery.Duration,
+		ToolCallTimeout:  c.Timeouts.ToolCall.Duration,
+		Tools:            c.Tools,
+		RateLimits:       c.RateLimits,
+		TraceQL:          c.TraceQL,
+		Guardrails:       c.Guardrails,
+		Redaction:        c.Redaction,
+		Truncation:       c.Truncation,
+		InstanceCacheTTL: c.Sessions.InstanceCacheTTL.Duration,
+	}
+}
+
+func (c *Config) MCPTransports() mcpserver.Transports {
+	return mcpserver.Transports{
+		StreamableHTTPPath: c.Transports.StreamableHTTPPath,
+		SSEPath:            c.Transports.SSEPath,
+	}
+}
+
+func (c *Config) ServerTLSOptions() tlsconfig.ServerOptions {
+	return tlsconfig.ServerOptions{
+		CertFile:          c.TLS.Cert,
+		KeyFile:           c.TLS.Key,
+		ClientCAFile:      c.TLS.ClientCA,
+		RequireClientCert: c.TLS.RequireClientCert,
+	}
+}
+
+func (c *Config) DownstreamTLSOptions() tlsconfig.ClientOptions {
+	return tlsconfig.ClientOptions{
+		CAFiles:            c.Downstream.CAFiles,
+		SystemCAs:          c.Downstream.SystemCA,
+		CertFile:           c.Downstream.Cert,
+		KeyFile:            c.Downstream.Key,
+		InsecureSkipVerify: c.Downstream.InsecureSkipVerify,
+	}
+}
+
+func (c *Config) TracingConfig() tracing.Config {
+	return tracing.Config{
+		Endpoint:    c.Tracing.OTLPEndpoint,
+		SampleRatio: c.Tracing.SampleRatio,
+	}
+}
+
+// RestartRequired returns the settings which changed between both configurations and cannot be applied at runtime.
+func RestartRequired(old *Config, new *Config) []string {
+	changed := []string{}
+	check := func(field string, a any, b any) {
+		if !reflect.DeepEqual(a, b) {
+			changed = append(changed, field)
+		}
+	}
+
+	check("listen", old.Listen, new.Listen)
+	check("transports", old.Transports, new.Transports)
+	check("sessions.enabled", old.Sessions.Enabled, new.Sessions.Enabled)
+	check("sessions.ttl", old.Sessions.TTL, new.Sessions.TTL)
+	check("sessions.store", old.Sessions.Store, new.Sessions.Store)
+	check("sessions.namespace", old.Sessions.Namespace, new.Sessions.Namespace)
+	check("metricsListen", old.MetricsListen, new.MetricsListen)
+	check("readOnly", old.ReadOnly, new.ReadOnly)
+	check("tls", old.TLS, new.TLS)
+	check("auth", old.Auth, new.Auth)
+	check("downstreamTLS", old.Downstream, new.Downstream)
+	check("timeouts.shutdown", old.Timeouts.Shutdown, new.Timeouts.Shutdown)
+	check("audit.stdout", old.Audit.Stdout, new.Audit.Stdout)
+	check("audit.file", old.Audit.File, new.Audit.File)
+	check("audit.webhook", old.Audit.Webhook, new.Audit.Webhook)
+	check("tracing", old.Tracing, new.Tracing)
+	check("log.format", old.Log.Format, new.Log.Format)
+	check("log.sampling", old.Log.Sampling, new.Log.Sampling)
+	return changed
+}
+
+// deepCopy copies the configuration, therefore parsing a file does not modify the maps and slices of the base configuration.
+func (c Config) deepCopy() (*Config, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func splitNamespacedName(s string) (string, string, error) {
+	namespace, name, ok := strings.Cut(s, "/")
+	if !ok || namespace == "" || name == "" {
+		return "", "", fmt.Errorf("expected <namespace>/<name>, got %q", s)
+	}
+	return namespace, name, nil
+}
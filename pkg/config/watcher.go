@@ -0,0 +1,96 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// Watcher reloads the configuration file when its content changes.
+// Invalid configurations are rejected and the last valid configuration stays active.
+type Watcher struct {
+	logger   *zap.Logger
+	path     string
+	base     Config
+	onChange func(old *Config, new *Config)
+
+	mu      sync.Mutex
+	data    []byte
+	current *Config
+	// The content of the last invalid file, which is reported only once
+	invalid []byte
+}
+
+// NewWatcher creates a watcher of the configuration file at path, which is applied on top of the base configuration.
+// onChange is called after a changed configuration was loaded successfully.
+func NewWatcher(logger *zap.Logger, path string, base Config, onChange func(old *Config, new *Config)) *Watcher {
+	return &Watcher{
+		logger:   logger,
+		path:     path,
+		base:     base,
+		onChange: onChange,
+	}
+}
+
+// Load reads the configuration file. If the content did not change since the last load, nothing happens.
+func (w *Watcher) Load() error {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.current != nil && (bytes.Equal(data, w.data) || bytes.Equal(data, w.invalid)) {
+		return nil
+	}
+
+	config, err := Parse(w.path, data, w.base)
+	if err != nil {
+		metrics.ConfigReloads.WithLabelValues("failure").Inc()
+		w.invalid = data
+		return err
+	}
+	metrics.ConfigReloads.WithLabelValues("success").Inc()
+
+	old := w.current
+	w.data = data
+	w.current = config
+	if old != nil && w.onChange != nil {
+		w.onChange(old, config)
+	}
+	return nil
+}
+
+// Current returns the last valid configuration.
+func (w *Watcher) Current() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Run reloads the configuration file periodically until the context is cancelled.
+// Polling the file content works with ConfigMap volumes, which replace the file by swapping a symlink.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := w.Load()
+			if err != nil {
+				w.logger.Error("error reloading config, keeping the last valid config", zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package guardrails
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type ActionType string
+
+const (
+	// Reduce arguments which exceed a limit to the limit.
+	ActionClamp ActionType = "clamp"
+	// Reject tool calls with arguments which exceed a limit.
+	ActionReject ActionType = "reject"
+)
+
+// Config limits the arguments of tool calls, which protects Tempo from expensive queries.
+type Config struct {
+	// clamp or reject. Defaults to clamp.
+	Action ActionType `json:"action,omitempty"`
+	// Default limits of all tenants and instances.
+	Limits Limits `json:"limits,omitempty"`
+	// Limits for specific tenants and instances (<namespace>/<name>).
+	// Instance limits take precedence over tenant limits, which take precedence over the default limits. Unset fields are inherited.
+	Overrides Overrides `json:"overrides,omitempty"`
+	// The guarded tools and the names of their arguments. Defaults to the TraceQL search and metrics tools of the Tempo MCP server.
+	Tools map[string]ToolArguments `json:"tools,omitempty"`
+}
+
+// Limits of the tool arguments. Zero values disable the respective limit.
+type Limits struct {
+	// Maximum time window between the start and end argument.
+	MaxWindow metav1.Duration `json:"maxWindow,omitempty"`
+	// Maximum number of results.
+	MaxLimit int `json:"maxLimit,omitempty"`
+	// Maximum number of spans per span set.
+	MaxSpansPerSpanSet int `json:"maxSpansPerSpanSet,omitempty"`
+}
+
+type Overrides struct {
+	Tenants   map[string]Limits `json:"tenants,omitempty"`
+	Instances map[string]Limits `json:"instances,omitempty"`
+}
+
+// ToolArguments are the names of the arguments of a tool. Empty names are not guarded.
+// Times are RFC 3339 timestamps or Unix epoch seconds.
+type ToolArguments struct {
+	Start           string `json:"start,omitempty"`
+	End             string `json:"end,omitempty"`
+	Limit           string `json:"limit,omitempty"`
+	SpansPerSpanSet string `json:"spansPerSpanSet,omitempty"`
+}
+
+// DefaultTools are the guarded tools of the Tempo MCP server.
+var DefaultTools = map[string]ToolArguments{
+	"traceql-search":          {Start: "start", End: "end", Limit: "limit", SpansPerSpanSet: "spss"},
+	"traceql-metrics-instant": {Start: "start", End: "end"},
+	"traceql-metrics-range":   {Start: "start", End: "end"},
+}
+
+// Times with more Unix epoch seconds (about year 5000) are rejected, which keeps the time arithmetic in range.
+const maxEpochSeconds = 1e11
+
+// LimitError is returned if an argument exceeds a limit and the action is reject.
+type LimitError struct {
+	Limit string
+}
+
+func (e *LimitError) Error() string {
+	return "the query exceeds the " + e.Limit
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	switch c.Action {
+	case "", ActionClamp, ActionReject:
+	default:
+		errs = append(errs, fmt.Errorf("action: invalid action %q, expected %s or %s", c.Action, ActionClamp, ActionReject))
+	}
+
+	validate := func(field string, limits Limits) {
+		if limits.MaxWindow.Duration < 0 || limits.MaxLimit < 0 || limits.MaxSpansPerSpanSet < 0 {
+			errs = append(errs, fmt.Errorf("%s: limits must not be negative", field))
+		}
+	}
+	validate("limits", c.Limits)
+	for _, tenant := range slices.Sorted(maps.Keys(c.Overrides.Tenants)) {
+		validate(fmt.Sprintf("overrides.tenants[%s]", tenant), c.Overrides.Tenants[tenant])
+	}
+	for _, instance := range slices.Sorted(maps.Keys(c.Overrides.Instances)) {
+		validate(fmt.Sprintf("overrides.instances[%s]", instance), c.Overrides.Instances[instance])
+	}
+	return errors.Join(errs...)
+}
+
+// scopedLimit is a limit together with the scope which configured it, for example "tenant 'prod'".
+type scopedLimit[T comparable] struct {
+	value T
+	scope string
+}
+
+func override[T comparable](limit *scopedLimit[T], value T, scope string) {
+	var zero T
+	if value != zero {
+		*limit = scopedLimit[T]{value: value, scope: scope}
+	}
+}
+
+// Apply checks the arguments of a tool call against the limits of the instance and tenant.
+// Missing arguments are set to the limits. It returns the arguments to forward and a description of each clamped or added argument.
+// If the action is reject, a LimitError is returned for the first exceeded limit.
+func (c Config) Apply(tool string, args map[string]any, instance string, tenant string, now time.Time) (map[string]any, []string, error) {
+	tools := c.Tools
+	if tools == nil {
+		tools = DefaultTools
+	}
+	toolArgs, ok := tools[tool]
+	if !ok {
+		return args, nil, nil
+	}
+
+	maxWindow := scopedLimit[time.Duration]{scope: "default"}
+	maxLimit := scopedLimit[int]{scope: "default"}
+	maxSPSS := scopedLimit[int]{scope: "default"}
+	for _, scoped := range []struct {
+		limits Limits
+		ok     bool
+		scope  string
+	}{
+		{c.Limits, true, "default"},
+		{c.Overrides.Tenants[tenant], tenant != "", fmt.Sprintf("tenant '%s'", tenant)},
+		{c.Overrides.Instances[instance], true, fmt.Sprintf("instance '%s'", instance)},
+	} {
+		if !scoped.ok {
+			continue
+		}
+		override(&maxWindow, scoped.limits.MaxWindow.Duration, scoped.scope)
+		override(&maxLimit, scoped.limits.MaxLimit, scoped.scope)
+		override(&maxSPSS, scoped.limits.MaxSpansPerSpanSet, scoped.scope)
+	}
+
+	applied := []string{}
+	forwardArgs := maps.Clone(args)
+	if forwardArgs == nil {
+		forwardArgs = map[string]any{}
+	}
+
+	if maxWindow.value > 0 && toolArgs.Start != "" {
+		msg, err := c.applyMaxWindow(forwardArgs, toolArgs, maxWindow, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		if msg != "" {
+			applied = append(applied, msg)
+		}
+	}
+
+	for _, limit := range []struct {
+		arg   string
+		name  string
+		limit scopedLimit[int]
+	}{
+		{toolArgs.Limit, "result limit", maxLimit},
+		{toolArgs.SpansPerSpanSet, "spans per span set limit", maxSPSS},
+	} {
+		if limit.limit.value <= 0 || limit.arg == "" {
+			continue
+		}
+		msg, err := c.applyMaxInt(forwardArgs, limit.arg, limit.name, limit.limit)
+		if err != nil {
+			return nil, nil, err
+		}
+		if msg != "" {
+			applied = append(applied, msg)
+		}
+	}
+
+	return forwardArgs, applied, nil
+}
+
+// applyMaxWindow limits the time window between the start and end argument.
+// A missing start argument is set to the start of the maximum time window, because Tempo would search without a time range.
+func (c Config) applyMaxWindow(args map[string]any, toolArgs ToolArguments, maxWindow scopedLimit[time.Duration], now time.Time) (string, error) {
+	var err error
+	end := now
+	var endValue any
+	if toolArgs.End != "" {
+		if value, ok := args[toolArgs.End]; ok {
+			endValue = value
+			end, err = parseTime(value)
+			if err != nil {
+				return "", fmt.Errorf("invalid %s argument: %w", toolArgs.End, err)
+			}
+		}
+	}
+
+	name := fmt.Sprintf("maximum time window of %s (%s)", maxWindow.value, maxWindow.scope)
+	startValue, ok := args[toolArgs.Start]
+	if !ok {
+		args[toolArgs.Start] = formatTime(end.Add(-maxWindow.value), endValue)
+		return fmt.Sprintf("%s was set to the start of the %s", toolArgs.Start, name), nil
+	}
+	start, err := parseTime(startValue)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s argument: %w", toolArgs.Start, err)
+	}
+
+	window := end.Sub(start)
+	if window <= maxWindow.value {
+		return "", nil
+	}
+
+	if c.Action == ActionReject {
+		return "", &LimitError{Limit: fmt.Sprintf("%s, the requested window is %s", name, window)}
+	}
+
+	// The most recent part of the time window is kept
+	args[toolArgs.Start] = formatTime(end.Add(-maxWindow.value), startValue)
+	return fmt.Sprintf("the time window was reduced from %s to the %s", window, name), nil
+}
+
+// applyMaxInt limits a numeric argument. A missing argument is set to the maximum, because the default of Tempo can exceed it.
+func (c Config) applyMaxInt(args map[string]any, arg string, name string, limit scopedLimit[int]) (string, error) {
+	fullName := fmt.Sprintf("maximum %s of %d (%s)", name, limit.value, limit.scope)
+	value, ok := args[arg]
+	if !ok {
+		args[arg] = limit.value
+		return fmt.Sprintf("%s was set to the %s", arg, fullName), nil
+	}
+	n, err := parseInt(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s argument: %w", arg, err)
+	}
+	if n <= limit.value {
+		return "", nil
+	}
+
+	if c.Action == ActionReject {
+		return "", &LimitError{Limit: fmt.Sprintf("%s, the requested %s is %d", fullName, arg, n)}
+	}
+
+	args[arg] = limit.value
+	return fmt.Sprintf("%s was reduced from %d to the %s", arg, n, fullName), nil
+}
+
+// parseTime parses an RFC 3339 timestamp or Unix epoch seconds, as string or number.
+func parseTime(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case float64:
+		if math.IsNaN(v) || math.Abs(v) > maxEpochSeconds {
+			return time.Time{}, fmt.Errorf("Unix epoch seconds out of range: %v", v)
+		}
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	case string:
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, nil
+		}
+		if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+			if sec < -maxEpochSeconds || sec > maxEpochSeconds {
+				return time.Time{}, fmt.Errorf("Unix epoch seconds out of range: %d", sec)
+			}
+			return time.Unix(sec, 0), nil
+		}
+		return time.Time{}, fmt.Errorf("expected an RFC 3339 timestamp or Unix epoch seconds, got %q", v)
+	default:
+		return time.Time{}, fmt.Errorf("expected an RFC 3339 timestamp or Unix epoch seconds, got %v", value)
+	}
+}
+
+// formatTime formats the time like the original argument.
+func formatTime(t time.Time, original any) any {
+	switch v := original.(type) {
+	case float64:
+		return float64(t.Unix())
+	case string:
+		if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return strconv.FormatInt(t.Unix(), 10)
+		}
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseInt parses a non-negative integer, as string or number.
+func parseInt(value any) (int, error) {
+	var n int64
+	switch v := value.(type) {
+	case float64:
+		if v != math.Trunc(v) || v < 0 || v > math.MaxInt32 {
+			return 0, fmt.Errorf("expected a non-negative integer up to %d, got %v", math.MaxInt32, v)
+		}
+		n = int64(v)
+	case string:
+		var err error
+		n, err = strconv.ParseInt(v, 10, 32)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("expected a non-negative integer up to %d, got %q", math.MaxInt32, v)
+		}
+	default:
+		return 0, fmt.Errorf("expected a number, got %v", value)
+	}
+	return int(n), nil
+}
@@ -0,0 +1,112 @@
+package guardrails
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestApply(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	limits := Limits{MaxWindow: metav1.Duration{Duration: time.Hour}, MaxLimit: 100, MaxSpansPerSpanSet: 10}
+
+	tests := []struct {
+		name    string
+		action  ActionType
+		args    map[string]any
+		want    map[string]any
+		applied int
+		err     bool
+	}{
+		{
+			name:    "within limits",
+			args:    map[string]any{"start": "2026-10-01T11:30:00Z", "limit": float64(20), "spss": float64(3)},
+			want:    map[string]any{"start": "2026-10-01T11:30:00Z", "limit": float64(20), "spss": float64(3)},
+			applied: 0,
+		},
+		{
+			name:    "clamp",
+			args:    map[string]any{"start": "2026-09-01T00:00:00Z", "end": "2026-10-01T10:00:00Z", "limit": float64(1000), "spss": "50"},
+			want:    map[string]any{"start": "2026-10-01T09:00:00Z", "end": "2026-10-01T10:00:00Z", "limit": 100, "spss": 10},
+			applied: 3,
+		},
+		{
+			name:    "missing arguments are set to the limits",
+			args:    map[string]any{"query": "{}"},
+			want:    map[string]any{"query": "{}", "start": "2026-10-01T11:00:00Z", "limit": 100, "spss": 10},
+			applied: 3,
+		},
+		{
+			name:    "missing start is formatted like the end",
+			args:    map[string]any{"end": "1790856000", "limit": float64(1), "spss": float64(1)},
+			want:    map[string]any{"end": "1790856000", "start": "1790852400", "limit": float64(1), "spss": float64(1)},
+			applied: 1,
+		},
+		{
+			name:   "reject",
+			action: ActionReject,
+			args:   map[string]any{"start": "2026-10-01T11:30:00Z", "limit": float64(101)},
+			err:    true,
+		},
+		{
+			name: "huge limit",
+			args: map[string]any{"start": "2026-10-01T11:30:00Z", "limit": 1e30},
+			err:  true,
+		},
+		{
+			name: "fractional limit",
+			args: map[string]any{"start": "2026-10-01T11:30:00Z", "limit": 1.5},
+			err:  true,
+		},
+		{
+			name: "negative limit",
+			args: map[string]any{"start": "2026-10-01T11:30:00Z", "limit": "-1"},
+			err:  true,
+		},
+		{
+			name: "start out of range",
+			args: map[string]any{"start": -1e30},
+			err:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config := Config{Action: tc.action, Limits: limits}
+			args, applied, err := config.Apply("traceql-search", tc.args, "tracing/prod", "", now)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, args)
+			require.Len(t, applied, tc.applied)
+		})
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	config := Config{
+		Action: ActionReject,
+		Limits: Limits{MaxLimit: 100},
+		Overrides: Overrides{
+			Tenants:   map[string]Limits{"prod": {MaxLimit: 10}},
+			Instances: map[string]Limits{"tracing/dev": {MaxLimit: 500}},
+		},
+	}
+	args := map[string]any{"limit": float64(50)}
+
+	_, _, err := config.Apply("traceql-search", args, "tracing/prod", "dev", time.Now())
+	require.NoError(t, err)
+
+	_, _, err = config.Apply("traceql-search", args, "tracing/prod", "prod", time.Now())
+	var limitErr *LimitError
+	require.True(t, errors.As(err, &limitErr))
+	require.Contains(t, limitErr.Limit, "tenant 'prod'")
+
+	_, _, err = config.Apply("traceql-search", args, "tracing/dev", "prod", time.Now())
+	require.NoError(t, err)
+}
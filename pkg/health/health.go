@@ -0,0 +1,127 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const checkTimeout = 5 * time.Second
+
+type StatusType string
+
+const (
+	StatusOK     StatusType = "ok"
+	StatusFailed StatusType = "failed"
+)
+
+// CheckFunc returns an error if the component is not ready.
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker runs the readiness checks of the gateway.
+type Checker struct {
+	checks       []check
+	shuttingDown atomic.Bool
+}
+
+type Response struct {
+	Status StatusType             `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type CheckResult struct {
+	Status StatusType `json:"status"`
+	Error  string     `json:"error,omitempty"`
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Add registers a readiness check. Checks must be added before the handlers are served.
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// Shutdown marks the gateway as not ready, regardless of the other checks.
+func (c *Checker) Shutdown() {
+	c.shuttingDown.Store(true)
+}
+
+// Check runs all checks concurrently, each with a timeout.
+func (c *Checker) Check(ctx context.Context) Response {
+	if c.shuttingDown.Load() {
+		return Response{
+			Status: StatusFailed,
+			Checks: map[string]CheckResult{"shutdown": {Status: StatusFailed, Error: "the gateway is shutting down"}},
+		}
+	}
+
+	resp := Response{
+		Status: StatusOK,
+		Checks: make(map[string]CheckResult, len(c.checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, chk := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			result := CheckResult{Status: StatusOK}
+			err := chk.fn(checkCtx)
+			if err != nil {
+				result = CheckResult{Status: StatusFailed, Error: err.Error()}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			resp.Checks[chk.name] = result
+			if err != nil {
+				resp.Status = StatusFailed
+			}
+		}()
+	}
+	wg.Wait()
+
+	return resp
+}
+
+// ReadyHandler serves the result of all readiness checks. It returns 503 if any check failed.
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := c.Check(r.Context())
+
+		status := http.StatusOK
+		if resp.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, resp)
+	})
+}
+
+// LiveHandler reports that the process is alive and serving HTTP requests.
+func LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Response{Status: StatusOK})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, resp Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	zaplogfmt "github.com/jsternberg/zap-logfmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type contextKey string
+
+const loggerKey contextKey = "logger"
+
+type FormatType string
+
+const (
+	FormatLogfmt FormatType = "logfmt"
+	FormatJSON   FormatType = "json"
+)
+
+type Config struct {
+	// debug, info, warn or error. The level can be changed at runtime.
+	Level string `json:"level,omitempty"`
+	// logfmt or json.
+	Format FormatType `json:"format,omitempty"`
+	// Limit the number of log entries with the same level and message. Disabled if not set.
+	Sampling *Sampling `json:"sampling,omitempty"`
+}
+
+// Sampling logs the first Initial entries with the same level and message per second, and every Thereafter-th entry after that.
+type Sampling struct {
+	Initial    int `json:"initial"`
+	Thereafter int `json:"thereafter"`
+}
+
+func (c Config) Validate() error {
+	_, err := zapcore.ParseLevel(c.Level)
+	if err != nil {
+		return fmt.Errorf("invalid level %q", c.Level)
+	}
+
+	switch c.Format {
+	case FormatLogfmt, FormatJSON:
+	default:
+		return fmt.Errorf("invalid format %q, expected %s or %s", c.Format, FormatLogfmt, FormatJSON)
+	}
+
+	if c.Sampling != nil && (c.Sampling.Initial <= 0 || c.Sampling.Thereafter <= 0) {
+		return fmt.Errorf("sampling.initial and sampling.thereafter must be positive")
+	}
+	return nil
+}
+
+// New creates a logger. The level can be changed at runtime with the returned level,
+// which also serves GET and PUT requests to read and change the level over HTTP.
+func New(config Config, out zapcore.WriteSyncer) (*zap.Logger, zap.AtomicLevel, error) {
+	err := config.Validate()
+	if err != nil {
+		return nil, zap.AtomicLevel{}, err
+	}
+
+	level, _ := zap.ParseAtomicLevel(config.Level)
+
+	var encoder zapcore.Encoder
+	switch config.Format {
+	case FormatJSON:
+		encoderConfig := zap.NewProductionEncoderConfig()
+		encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	default:
+		encoder = zaplogfmt.NewEncoder(zap.NewDevelopmentEncoderConfig())
+	}
+
+	core := zapcore.NewCore(encoder, out, level)
+	if config.Sampling != nil {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, config.Sampling.Initial, config.Sampling.Thereafter)
+	}
+
+	return zap.New(core), level, nil
+}
+
+// WithLogger stores a request-scoped logger in the context.
+func WithLogger(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the request-scoped logger, or the fallback logger outside of a request.
+func FromContext(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	logger, ok := ctx.Value(loggerKey).(*zap.Logger)
+	if !ok {
+		return fallback
+	}
+	return logger
+}
+
+// With adds fields to the request-scoped logger in the context.
+func With(ctx context.Context, fallback *zap.Logger, fields ...zap.Field) context.Context {
+	return WithLogger(ctx, FromContext(ctx, fallback).With(fields...))
+}
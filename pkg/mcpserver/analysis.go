@@ -0,0 +1,192 @@
+package mcpserver
+
+import (
+	"context"
+	"maps"
+	"strings"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tempodiscovery"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/traces"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// registerAnalysisTools registers the tools which fetch traces from the Tempo API and analyze them in the gateway.
+func (s *MCPServer) registerAnalysisTools() {
+	options := append([]mcp.ToolOption{
+		mcp.WithDescription(`Summarize a trace: services, operations, the span hierarchy with durations, the critical path, error spans and the most common attributes.
+Prefer this tool over get-trace to understand a trace, the output is much smaller than the raw trace.`),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithOpenWorldHintAnnotation(false),
+		mcp.WithString("traceId",
+			mcp.Required(),
+			mcp.Description("The ID of the trace in hex"),
+		),
+		mcp.WithNumber("maxDepth",
+			mcp.Description("Maximum depth of the span hierarchy. Deeper spans are counted, but not listed."),
+			mcp.DefaultNumber(5),
+			mcp.Min(1),
+		),
+		mcp.WithNumber("maxSpans",
+			mcp.Description("Maximum number of lines of the span hierarchy and of the critical path. Repeated sibling spans are collapsed into one line."),
+			mcp.DefaultNumber(50),
+			mcp.Min(1),
+		),
+		mcp.WithNumber("topAttributes",
+			mcp.Description("Number of listed attributes, and of values per attribute"),
+			mcp.DefaultNumber(5),
+			mcp.Min(0),
+		),
+		mcp.WithNumber("maxErrors",
+			mcp.Description("Maximum number of listed error spans. All error spans are counted."),
+			mcp.DefaultNumber(20),
+			mcp.Min(0),
+		),
+	}, instanceParameters()...)
+
+	s.mcpServer.AddTool(mcp.NewTool("summarize-trace", options...), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		trace, result := s.fetchTraceForTool(ctx, request)
+		if result != nil {
+			return result, nil
+		}
+
+		summary := trace.Summarize(traces.SummaryOptions{
+			MaxDepth:      max(1, request.GetInt("maxDepth", 5)),
+			MaxSpans:      max(1, request.GetInt("maxSpans", 50)),
+			TopAttributes: max(0, request.GetInt("topAttributes", 5)),
+			MaxErrors:     max(0, request.GetInt("maxErrors", 20)),
+		})
+		result = mcp.NewToolResultStructured(summary, summary.Text())
+		s.truncate(ctx, result, request.Params.Name)
+		return result, nil
+	})
+
+	options = append([]mcp.ToolOption{
+		mcp.WithDescription(`Explain where the time of a trace went: the critical path, the self time per service and operation, and gaps in which no child span was active.
+Returns a short explanation and the exact numbers, use it instead of computing durations from a raw trace.`),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithOpenWorldHintAnnotation(false),
+		mcp.WithString("traceId",
+			mcp.Required(),
+			mcp.Description("The ID of the trace in hex"),
+		),
+		mcp.WithNumber("maxItems",
+			mcp.Description("Maximum number of critical path steps, operations and gaps"),
+			mcp.DefaultNumber(10),
+			mcp.Min(1),
+		),
+	}, instanceParameters()...)
+
+	s.mcpServer.AddTool(mcp.NewTool("critical-path", options...), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		trace, result := s.fetchTraceForTool(ctx, request)
+		if result != nil {
+			return result, nil
+		}
+
+		breakdown := trace.Breakdown(max(1, request.GetInt("maxItems", 10)))
+		result = mcp.NewToolResultStructured(breakdown, breakdown.Text())
+		s.truncate(ctx, result, request.Params.Name)
+		return result, nil
+	})
+
+	options = append([]mcp.ToolOption{
+		mcp.WithDescription(`Compare two traces, e.g. a slow request with a fast request of the same endpoint, or a request of today with a request of yesterday.
+Reports spans which were added or removed per service and operation, the change of the self time and critical path time per service and operation, and attribute and status differences of matching spans.
+The traces can be stored in different Tempo instances or tenants.`),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithOpenWorldHintAnnotation(false),
+		mcp.WithString("traceId",
+			mcp.Required(),
+			mcp.Description("The ID of the baseline trace in hex, e.g. the fast request"),
+		),
+		mcp.WithString("compareTraceId",
+			mcp.Required(),
+			mcp.Description("The ID of the compared trace in hex, e.g. the slow request"),
+		),
+		mcp.WithString("compareTempoNamespace",
+			mcp.Description("The namespace of the Tempo instance of the compared trace. Defaults to tempoNamespace."),
+		),
+		mcp.WithString("compareTempoName",
+			mcp.Description("The name of the Tempo instance of the compared trace. Defaults to tempoName."),
+		),
+		mcp.WithString("compareTenant",
+			mcp.Description("The tenant of the compared trace. Defaults to tenant."),
+		),
+		mcp.WithNumber("maxItems",
+			mcp.Description("Maximum number of span count, operation and attribute changes"),
+			mcp.DefaultNumber(20),
+			mcp.Min(1),
+		),
+	}, instanceParameters()...)
+
+	s.mcpServer.AddTool(mcp.NewTool("diff-traces", options...), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		baseline, result := s.fetchTraceForTool(ctx, request)
+		if result != nil {
+			return result, nil
+		}
+		compared, result := s.fetchComparedTraceForTool(ctx, request)
+		if result != nil {
+			return result, nil
+		}
+
+		diff := traces.Compare(baseline, compared, max(1, request.GetInt("maxItems", 20)))
+		result = mcp.NewToolResultStructured(diff, diff.Text())
+		s.truncate(ctx, result, request.Params.Name)
+		return result, nil
+	})
+}
+
+// fetchTraceForTool fetches the trace of the traceId argument from the Tempo instance of the tool call.
+// If the trace cannot be fetched, a tool error result is returned.
+func (s *MCPServer) fetchTraceForTool(ctx context.Context, request mcp.CallToolRequest) (*traces.Trace, *mcp.CallToolResult) {
+	traceID, err := request.RequireString("traceId")
+	if err != nil {
+		return nil, mcp.NewToolResultError(err.Error())
+	}
+
+	ctx, instance, tenant, errResult := s.resolveTarget(ctx, request, toolTarget)
+	if errResult != nil {
+		return nil, errResult
+	}
+	return s.fetchTraceFrom(ctx, instance, tenant, traceID)
+}
+
+// fetchComparedTraceForTool fetches the trace of the compareTraceId argument.
+// The instance and tenant default to the instance and tenant of the tool call, and are recorded as an additional target of the tool call.
+func (s *MCPServer) fetchComparedTraceForTool(ctx context.Context, request mcp.CallToolRequest) (*traces.Trace, *mcp.CallToolResult) {
+	traceID, err := request.RequireString("compareTraceId")
+	if err != nil {
+		return nil, mcp.NewToolResultError(err.Error())
+	}
+
+	args := maps.Clone(request.GetArguments())
+	for _, arg := range []string{"tempoNamespace", "tempoName", "tenant"} {
+		compareArg := "compare" + strings.ToUpper(arg[:1]) + arg[1:]
+		if value, _ := args[compareArg].(string); value == "" {
+			args[compareArg] = args[arg]
+		}
+	}
+	request.Params.Arguments = args
+
+	ctx, instance, tenant, errResult := s.resolveTarget(ctx, request, compareTarget)
+	if errResult != nil {
+		return nil, errResult
+	}
+	return s.fetchTraceFrom(ctx, instance, tenant, traceID)
+}
+
+func (s *MCPServer) fetchTraceFrom(ctx context.Context, instance tempodiscovery.TempoInstance, tenant string, traceID string) (*traces.Trace, *mcp.CallToolResult) {
+	ctx, done, rejected := s.startInstanceCall(ctx, instance, tenant)
+	if rejected != nil {
+		return nil, rejected
+	}
+	defer done()
+
+	trace, err := s.fetchTrace(ctx, instance, tenant, traceID)
+	if err != nil {
+		return nil, mcp.NewToolResultError(err.Error())
+	}
+	return trace, nil
+}
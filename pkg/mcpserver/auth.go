@@ -0,0 +1,155 @@
+package mcpserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/auth"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/logging"
+	"go.uber.org/zap"
+)
+
+type contextKey string
+
+const (
+	authTokenKey   contextKey = "authToken"
+	tokenSourceKey contextKey = "tokenSource"
+)
+
+// APIKeyHeader is the HTTP header which holds the API key.
+const APIKeyHeader = "X-API-Key"
+
+// ErrUnmappedCertificate is returned for requests with a client certificate and without a bearer token,
+// if the certificate identity is not mapped to any tenant.
+var ErrUnmappedCertificate = errors.New("client certificate is not mapped to any tenant, send a bearer token")
+
+func WithAuthToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, authTokenKey, token)
+}
+
+func AuthTokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(authTokenKey).(string)
+	return token
+}
+
+// WithTokenSource stores a token source in the context, which is read on every downstream request.
+// It is used instead of a fixed token when the credentials can be refreshed during a session, for example with the stdio transport.
+func WithTokenSource(ctx context.Context, tokens auth.TokenSource) context.Context {
+	return context.WithValue(ctx, tokenSourceKey, tokens)
+}
+
+// downstreamToken returns the token used for downstream requests.
+func downstreamToken(ctx context.Context) (string, error) {
+	if tokens, ok := ctx.Value(tokenSourceKey).(auth.TokenSource); ok {
+		return tokens.Token()
+	}
+	return AuthTokenFromContext(ctx), nil
+}
+
+// authenticate resolves the credentials of a request to the token used for downstream requests.
+//
+// Requests with an API key get the identity of the API key and use the gateway service account token downstream.
+// Requests with a bearer token forward their token, and get the user and groups of the token if it is a Kubernetes token. Requests with a verified client certificate get
+// the identity of the certificate subject. If no bearer token is present, they use the gateway service account token downstream,
+// restricted to the tenants mapped to the certificate identity.
+func (s *MCPServer) authenticate(r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+
+	apiKey := r.Header.Get(APIKeyHeader)
+	if apiKey != "" && s.apiKeys != nil {
+		identity, err := s.apiKeys.Authenticate(apiKey)
+		if err != nil {
+			return ctx, err
+		}
+		return s.withServiceAccountToken(ctx, identity)
+	}
+
+	var certIdentity *auth.Identity
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		certIdentity = auth.IdentityFromCertificate(r.TLS.VerifiedChains[0][0])
+	}
+
+	rawToken := r.Header.Get("Authorization")
+	if rawToken != "" {
+		token := strings.TrimPrefix(rawToken, "Bearer ")
+		if certIdentity != nil {
+			ctx = auth.WithIdentity(ctx, certIdentity)
+		} else if s.tokenReviewer != nil {
+			identity, err := s.tokenReviewer.Identity(ctx, token)
+			if err != nil {
+				return ctx, err
+			}
+			if identity != nil {
+				ctx = auth.WithIdentity(ctx, identity)
+			}
+		}
+		return WithAuthToken(ctx, token), nil
+	}
+
+	if certIdentity != nil {
+		// The service account token of the gateway has access to all tenants, therefore a client certificate
+		// without a bearer token is only accepted if its identity is mapped to tenants
+		tenants, ok := s.certificateTenants.AllowedTenants(certIdentity)
+		if !ok {
+			return ctx, ErrUnmappedCertificate
+		}
+		certIdentity.AllowedTenants = tenants
+		return s.withServiceAccountToken(ctx, certIdentity)
+	}
+
+	return WithAuthToken(ctx, ""), nil
+}
+
+func (s *MCPServer) withServiceAccountToken(ctx context.Context, identity *auth.Identity) (context.Context, error) {
+	token, err := s.serviceAccountToken.Token()
+	if err != nil {
+		return ctx, err
+	}
+
+	ctx = auth.WithIdentity(ctx, identity)
+	return WithAuthToken(ctx, token), nil
+}
+
+// callerName returns a stable name of the caller.
+// Callers with a bearer token and without a known identity, for example if the token is not a Kubernetes token, are named by a hash of their token.
+func callerName(ctx context.Context) string {
+	if identity := auth.IdentityFromContext(ctx); identity != nil {
+		return identity.Name
+	}
+
+	token := AuthTokenFromContext(ctx)
+	if token == "" {
+		return "anonymous"
+	}
+	hash := sha256.Sum256([]byte(token))
+	return "token-" + hex.EncodeToString(hash[:6])
+}
+
+// authMiddleware authenticates every HTTP request and stores the credentials in the request context.
+func (s *MCPServer) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := s.authenticate(r)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidAPIKey) || errors.Is(err, auth.ErrExpiredAPIKey) || errors.Is(err, ErrUnmappedCertificate) {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if errors.Is(err, auth.ErrTokenReviewFailed) {
+				logging.FromContext(r.Context(), s.logger).Error("error authenticating request", zap.Error(err))
+				http.Error(w, auth.ErrTokenReviewFailed.Error()+", retry later", http.StatusServiceUnavailable)
+				return
+			}
+
+			logging.FromContext(r.Context(), s.logger).Error("error authenticating request", zap.Error(err))
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		ctx = logging.With(ctx, s.logger, zap.String("identity", callerName(ctx)))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
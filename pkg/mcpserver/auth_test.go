@@ -0,0 +1,162 @@
+package mcpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/auth"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tempodiscovery"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// authResult is the outcome of authenticating a request with the auth middleware.
+type authResult struct {
+	status   int
+	body     string
+	identity *auth.Identity
+	token    string
+}
+
+func testServer(t *testing.T) *MCPServer {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("gateway-token"), 0o600))
+	return &MCPServer{logger: zap.NewNop(), serviceAccountToken: auth.TokenFile(tokenFile)}
+}
+
+func authenticateRequest(s *MCPServer, r *http.Request) authResult {
+	result := authResult{}
+	handler := s.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result.identity = auth.IdentityFromContext(r.Context())
+		result.token = AuthTokenFromContext(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	result.status = w.Code
+	result.body = w.Body.String()
+	return result
+}
+
+func TestAuthenticateClientCertificate(t *testing.T) {
+	s := testServer(t)
+	s.certificateTenants = auth.CertificateTenants{
+		Users:  map[string][]string{"alice": {"prod", "dev"}},
+		Groups: map[string][]string{"sre": {"*"}},
+	}
+
+	tests := []struct {
+		name           string
+		subject        pkix.Name
+		bearerToken    string
+		status         int
+		token          string
+		allowedTenants []string
+	}{
+		{
+			name:    "unmapped certificate",
+			subject: pkix.Name{CommonName: "bob", Organization: []string{"dev"}},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:           "mapped user",
+			subject:        pkix.Name{CommonName: "alice"},
+			status:         http.StatusOK,
+			token:          "gateway-token",
+			allowedTenants: []string{"dev", "prod"},
+		},
+		{
+			name:    "group with all tenants",
+			subject: pkix.Name{CommonName: "bob", Organization: []string{"sre"}},
+			status:  http.StatusOK,
+			token:   "gateway-token",
+		},
+		{
+			name:        "unmapped certificate with bearer token",
+			subject:     pkix.Name{CommonName: "bob"},
+			bearerToken: "user-token",
+			status:      http.StatusOK,
+			token:       "user-token",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: tc.subject}}}}
+			if tc.bearerToken != "" {
+				r.Header.Set("Authorization", "Bearer "+tc.bearerToken)
+			}
+
+			result := authenticateRequest(s, r)
+			require.Equal(t, tc.status, result.status)
+			if tc.status != http.StatusOK {
+				require.Contains(t, result.body, ErrUnmappedCertificate.Error())
+				return
+			}
+			require.Equal(t, tc.token, result.token)
+			require.Equal(t, tc.subject.CommonName, result.identity.Name)
+			require.Equal(t, auth.MethodClientCert, result.identity.Method)
+			require.Equal(t, tc.allowedTenants, result.identity.AllowedTenants)
+		})
+	}
+}
+
+func TestAuthenticateTokenReview(t *testing.T) {
+	reviews := 0
+	k8sClient := fake.NewClientBuilder().WithScheme(tempodiscovery.Scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			review := obj.(*authenticationv1.TokenReview)
+			reviews++
+			switch review.Spec.Token {
+			case "kubernetes-token":
+				review.Status.Authenticated = true
+				review.Status.User = authenticationv1.UserInfo{Username: "system:serviceaccount:ci:bot", Groups: []string{"system:serviceaccounts:ci"}}
+			case "forbidden":
+				return apierrors.NewForbidden(schema.GroupResource{Group: "authentication.k8s.io", Resource: "tokenreviews"}, "", nil)
+			}
+			return nil
+		},
+	}).Build()
+
+	s := testServer(t)
+	s.tokenReviewer = auth.NewTokenReviewer(k8sClient)
+
+	request := func(token string) authResult {
+		r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		return authenticateRequest(s, r)
+	}
+
+	result := request("kubernetes-token")
+	require.Equal(t, http.StatusOK, result.status)
+	require.Equal(t, "kubernetes-token", result.token)
+	require.Equal(t, &auth.Identity{Name: "system:serviceaccount:ci:bot", Groups: []string{"system:serviceaccounts:ci"}, Method: auth.MethodBearerToken}, result.identity)
+
+	// The result is cached
+	request("kubernetes-token")
+	require.Equal(t, 1, reviews)
+
+	// Tokens which are not Kubernetes tokens are forwarded without an identity
+	result = request("oidc-token")
+	require.Equal(t, http.StatusOK, result.status)
+	require.Equal(t, "oidc-token", result.token)
+	require.Nil(t, result.identity)
+
+	result = request("forbidden")
+	require.Equal(t, http.StatusServiceUnavailable, result.status)
+	require.Contains(t, result.body, auth.ErrTokenReviewFailed.Error())
+}
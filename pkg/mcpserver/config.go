@@ -0,0 +1,79 @@
+package mcpserver
+
+import (
+	"context"
+	"time"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/auth"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/guardrails"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/policy"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/ratelimit"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/redaction"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tempodiscovery"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/traceql"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/truncation"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Config holds the settings of the MCP server which can be changed at runtime.
+type Config struct {
+	Discovery tempodiscovery.Config
+	// Timeout of the discovery of Tempo instances. No timeout if zero.
+	DiscoveryTimeout time.Duration
+	// Timeout of a tool call to the Tempo MCP server. No timeout if zero.
+	ToolCallTimeout time.Duration
+	// Decides which tools a caller may list and call.
+	Tools policy.Config
+	// Syntax validation and lints of TraceQL queries.
+	TraceQL traceql.Config
+	// Time window, result limit and cost caps of the arguments of TraceQL tools.
+	Guardrails guardrails.Config
+	// Rate limits and concurrency caps of proxied tool calls.
+	RateLimits ratelimit.Config
+	// Redaction of span attributes in tool results.
+	Redaction redaction.Config
+	// Size limits of tool results.
+	Truncation truncation.Config
+	// How long the Tempo instances accessible to a stateful session are cached. Not cached if zero.
+	InstanceCacheTTL time.Duration
+}
+
+// Reconfigure applies new settings. Tool calls in progress keep the previous settings.
+func (s *MCPServer) Reconfigure(config Config) {
+	s.config.Store(&config)
+	s.limiter.SetConfig(config.RateLimits)
+	s.redactor.SetConfig(config.Redaction)
+}
+
+func (s *MCPServer) currentConfig() *Config {
+	return s.config.Load()
+}
+
+// toolAllowed returns true if the tool policy allows the caller to use the tool.
+// Tools are classified by the tool policy, the annotations of the tool are not used.
+func (s *MCPServer) toolAllowed(ctx context.Context, tool mcp.Tool) bool {
+	tools := s.currentConfig().Tools
+	sideEffect, known := tools.Classify(tool.Name)
+	if !known && !tools.AllowUnclassified {
+		return false
+	}
+
+	var groups []string
+	if identity := auth.IdentityFromContext(ctx); identity != nil {
+		groups = identity.Groups
+	}
+	rules := tools.RulesFor(callerName(ctx), groups)
+	return rules.Allowed(tool.Name, sideEffect == policy.SideEffectNone)
+}
+
+// filterTools computes the tools/list response of the caller.
+// It removes the tools which the caller may not use and adjusts the instance and tenant parameters to the targets of the caller.
+func (s *MCPServer) filterTools(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+	filtered := make([]mcp.Tool, 0, len(tools))
+	for _, tool := range tools {
+		if s.toolAllowed(ctx, tool) {
+			filtered = append(filtered, tool)
+		}
+	}
+	return s.filterToolsByTargets(ctx, filtered)
+}
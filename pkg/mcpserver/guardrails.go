@@ -0,0 +1,35 @@
+package mcpserver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/guardrails"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/logging"
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.uber.org/zap"
+)
+
+// applyGuardrails checks the arguments of a tool call against the query guardrails.
+// It returns the arguments to forward and the applied limits, or a tool error result if the call is rejected.
+func (s *MCPServer) applyGuardrails(ctx context.Context, request mcp.CallToolRequest, instance string, tenant string) (map[string]any, []string, *mcp.CallToolResult) {
+	args, applied, err := s.currentConfig().Guardrails.Apply(request.Params.Name, request.GetArguments(), instance, tenant, time.Now())
+	if err != nil {
+		toolCallFromContext(ctx).Outcome = OutcomeRejected
+		result := mcp.NewToolResultError(err.Error())
+
+		var limitErr *guardrails.LimitError
+		if errors.As(err, &limitErr) {
+			result.Meta = mcp.NewMetaFromMap(map[string]any{
+				"guardrails": []string{limitErr.Limit},
+			})
+		}
+		return nil, nil, result
+	}
+
+	if len(applied) > 0 {
+		logging.FromContext(ctx, s.logger).Debug("guardrails applied", zap.Strings("guardrails", applied))
+	}
+	return args, applied, nil
+}
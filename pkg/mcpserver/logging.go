@@ -0,0 +1,73 @@
+package mcpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/logging"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader is the HTTP header which holds the ID of a request. A new ID is generated if the client does not send one.
+const RequestIDHeader = "X-Request-Id"
+
+// maxPeekSize is the maximum size of a request body which is parsed for the request logger.
+const maxPeekSize = 1 << 20
+
+// jsonRPCRequest holds the fields of a JSON-RPC request which are added to the request logger.
+type jsonRPCRequest struct {
+	Method string `json:"method"`
+	Params struct {
+		Name string `json:"name"`
+	} `json:"params"`
+}
+
+// requestLogMiddleware stores a logger with the request ID, MCP method, tool name and trace ID in the request context.
+// The identity is added by the authMiddleware, and the target instance by the tool handler.
+func (s *MCPServer) requestLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		fields := []zap.Field{zap.String("request_id", requestID)}
+		if r.Method == http.MethodPost && r.ContentLength <= maxPeekSize {
+			if msg, ok := peekJSONRPCRequest(r); ok {
+				fields = append(fields, zap.String("mcp_method", msg.Method))
+				if msg.Method == "tools/call" {
+					fields = append(fields, zap.String("tool", msg.Params.Name))
+				}
+			}
+		}
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.IsValid() {
+			fields = append(fields, zap.String("trace_id", spanContext.TraceID().String()))
+		}
+
+		ctx := logging.WithLogger(r.Context(), s.logger.With(fields...))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// peekJSONRPCRequest parses a single JSON-RPC request from the request body, and restores the body for the next handler.
+func peekJSONRPCRequest(r *http.Request) (jsonRPCRequest, bool) {
+	var msg jsonRPCRequest
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPeekSize+1))
+	if err != nil {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		return msg, false
+	}
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+
+	err = json.Unmarshal(body, &msg)
+	if err != nil || msg.Method == "" {
+		return msg, false
+	}
+	return msg, true
+}
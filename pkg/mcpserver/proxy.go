@@ -4,35 +4,31 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"strings"
+	"time"
 
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/metrics"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tempodiscovery"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tracing"
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/client/transport"
 	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type contextKey string
+func (s *MCPServer) listRemoteTools(ctx context.Context, instance tempodiscovery.TempoInstance, tenant string) (_ *mcp.ListToolsResult, err error) {
+	ctx, span := tracing.Tracer.Start(ctx, "downstream tools/list", trace.WithAttributes(
+		attribute.String("tempo.instance", instance.String()),
+		attribute.String("tempo.tenant", tenant),
+	))
+	defer func() { tracing.EndSpan(span, err) }()
 
-const authTokenKey contextKey = "authToken"
-
-func WithAuthTokenFromHeader(ctx context.Context, header http.Header) context.Context {
-	rawToken := header.Get("Authorization")
-	token := strings.TrimPrefix(rawToken, "Bearer ")
-	return context.WithValue(ctx, authTokenKey, token)
-}
-
-func AuthTokenFromContext(ctx context.Context) string {
-	value := ctx.Value(authTokenKey)
-	token := value.(string)
-	return token
-}
-
-func (s *MCPServer) listRemoteTools(ctx context.Context, endpoint string) (*mcp.ListToolsResult, error) {
-	mcpClient, err := s.createMcpClient(ctx, endpoint)
+	mcpClient, err := s.createMcpClient(ctx, instance, tenant)
 	if err != nil {
 		return nil, err
 	}
-	defer mcpClient.Close()
+	defer func() { _ = s.downstream.close(mcpClient) }()
 
 	toolsRequest := mcp.ListToolsRequest{}
 	toolsResult, err := mcpClient.ListTools(ctx, toolsRequest)
@@ -43,12 +39,19 @@ func (s *MCPServer) listRemoteTools(ctx context.Context, endpoint string) (*mcp.
 	return toolsResult, nil
 }
 
-func (s *MCPServer) callRemoteTool(ctx context.Context, endpoint string, toolName string, args map[string]any) (*mcp.CallToolResult, error) {
-	mcpClient, err := s.createMcpClient(ctx, endpoint)
+func (s *MCPServer) callRemoteTool(ctx context.Context, instance tempodiscovery.TempoInstance, tenant string, toolName string, args map[string]any) (_ *mcp.CallToolResult, err error) {
+	ctx, span := tracing.Tracer.Start(ctx, "downstream tools/call "+toolName, trace.WithAttributes(
+		attribute.String("mcp.tool.name", toolName),
+		attribute.String("tempo.instance", instance.String()),
+		attribute.String("tempo.tenant", tenant),
+	))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	mcpClient, release, err := s.downstreamClient(ctx, instance, tenant)
 	if err != nil {
 		return nil, err
 	}
-	defer mcpClient.Close()
+	defer func() { release(err) }()
 
 	// Remove additional arguments which are not present in downstream MCP server
 	forwardArgs := make(map[string]any)
@@ -69,22 +72,75 @@ func (s *MCPServer) callRemoteTool(ctx context.Context, endpoint string, toolNam
 	return result, nil
 }
 
-func (s *MCPServer) createMcpClient(ctx context.Context, endpoint string) (*client.Client, error) {
+// downstreamClient returns a client for a tool call. Stateful sessions reuse the downstream session of previous tool calls.
+// The release function must be called with the error of the tool call, failed downstream sessions are not reused.
+func (s *MCPServer) downstreamClient(ctx context.Context, instance tempodiscovery.TempoInstance, tenant string) (*client.Client, func(error), error) {
+	sess := sessionFromContext(ctx)
+	if sess == nil {
+		mcpClient, err := s.createMcpClient(ctx, instance, tenant)
+		if err != nil {
+			return nil, nil, err
+		}
+		return mcpClient, func(error) { _ = s.downstream.close(mcpClient) }, nil
+	}
+
+	// A new downstream session is created if the token of the caller changed
+	token, err := downstreamToken(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := poolKey(instance, tenant)
+	mcpClient := s.pool.get(sess.ID, key, token)
+	if mcpClient == nil {
+		mcpClient, err = s.createMcpClient(ctx, instance, tenant)
+		if err != nil {
+			return nil, nil, err
+		}
+		if replaced := s.pool.put(sess.ID, key, token, mcpClient); replaced != nil {
+			_ = s.downstream.close(replaced)
+		}
+	}
+
+	release := func(err error) {
+		if err != nil {
+			s.pool.remove(sess.ID, key, mcpClient)
+			_ = s.downstream.close(mcpClient)
+		}
+	}
+	return mcpClient, release, nil
+}
+
+func (s *MCPServer) createMcpClient(ctx context.Context, instance tempodiscovery.TempoInstance, tenant string) (*client.Client, error) {
+	tlsConfig, err := s.tlsClient.Config(ctx, instance.CABundle)
+	if err != nil {
+		return nil, err
+	}
+
+	authToken, err := downstreamToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	headers := map[string]string{}
-	authToken := AuthTokenFromContext(ctx)
 	if authToken != "" {
 		headers["Authorization"] = fmt.Sprintf("Bearer %s", authToken)
 	}
 
-	httpTransport, err := transport.NewStreamableHTTP(endpoint,
+	roundTripper := &http.Transport{
+		TLSClientConfig: tlsConfig,
+	}
+	httpTransport, err := transport.NewStreamableHTTP(instance.GetMCPEndpoint(tenant),
 		transport.WithHTTPHeaders(headers),
 		transport.WithHTTPBasicClient(&http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: s.tlsConfig,
-			},
+			// The otelhttp transport injects the W3C traceparent header, therefore the spans of Tempo join the trace of the gateway
+			Transport: otelhttp.NewTransport(roundTripper),
 		}),
 	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MCP transport: %w", err)
+	}
 	mcpClient := client.NewClient(httpTransport)
+	s.downstream.add(mcpClient, roundTripper)
 
 	initReq := mcp.InitializeRequest{}
 	initReq.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
@@ -93,11 +149,16 @@ func (s *MCPServer) createMcpClient(ctx context.Context, endpoint string) (*clie
 		Version: MCP_VERSION,
 	}
 
-	_, err = mcpClient.Initialize(ctx, initReq)
+	initCtx, span := tracing.Tracer.Start(ctx, "downstream initialize")
+	start := time.Now()
+	_, err = mcpClient.Initialize(initCtx, initReq)
+	tracing.EndSpan(span, err)
 	if err != nil {
-		_ = mcpClient.Close()
+		metrics.DownstreamInitializeDuration.WithLabelValues(string(OutcomeError)).Observe(time.Since(start).Seconds())
+		_ = s.downstream.close(mcpClient)
 		return nil, fmt.Errorf("failed to initialize MCP client: %w", err)
 	}
+	metrics.DownstreamInitializeDuration.WithLabelValues(string(OutcomeSuccess)).Observe(time.Since(start).Seconds())
 
 	return mcpClient, nil
 }
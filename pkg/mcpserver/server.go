@@ -2,13 +2,28 @@ package mcpserver
 
 import (
 	"context"
-	"crypto/tls"
+	"errors"
 	"fmt"
-
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/audit"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/auth"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/logging"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/policy"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/ratelimit"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/redaction"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/session"
 	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tempodiscovery"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tlsconfig"
 	tempov1alpha1 "github.com/grafana/tempo-operator/api/tempo/v1alpha1"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.uber.org/zap"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -17,21 +32,98 @@ const MCP_NAME = "tempo-mcp-gateway"
 const MCP_VERSION = "v1.0.0"
 
 type MCPServer struct {
-	logger    *zap.Logger
-	k8sClient client.Client
-	tlsConfig *tls.Config
-	readOnly  bool
-
-	mcpServer        *server.MCPServer
-	HttpServer       *server.StreamableHTTPServer
+	logger        *zap.Logger
+	k8sClient     client.Client
+	tlsClient     *tlsconfig.Client
+	readOnly      bool
+	apiKeys       *auth.APIKeyStore
+	tokenReviewer *auth.TokenReviewer
+	limiter       *ratelimit.Limiter
+	redactor      *redaction.Redactor
+	auditor       *audit.Auditor
+	config        atomic.Pointer[Config]
+
+	serviceAccountToken auth.TokenFile
+	certificateTenants  auth.CertificateTenants
+
+	mcpServer  *server.MCPServer
+	httpServer *server.StreamableHTTPServer
+	sseServer  *server.SSEServer
+	transports Transports
+
+	toolsMu          sync.Mutex
 	toolsInitialized bool
+	// The error of the last attempt to load the tools, if they were not loaded yet.
+	toolsErr error
+
+	calls      callTracker
+	downstream downstreamClients
+
+	sessionStore session.Store
+	sessionTTL   time.Duration
+	pool         downstreamPool
 }
 
-func New(logger *zap.Logger, k8sClient client.Client, tlsConfig *tls.Config, readOnly bool) *MCPServer {
+type Options struct {
+	// Only expose readonly tools.
+	ReadOnly bool
+	// Accept API keys from this store in addition to bearer tokens. Optional.
+	APIKeys *auth.APIKeyStore
+	// Resolve the user and groups of bearer tokens, which are matched by the tool policy. Optional.
+	TokenReviewer *auth.TokenReviewer
+	// The token used for downstream requests of callers authenticated with an API key or a client certificate.
+	ServiceAccountToken auth.TokenFile
+	// The tenants of callers authenticated with a client certificate and without a bearer token.
+	// Such callers are rejected unless their identity is mapped to tenants.
+	CertificateTenants auth.CertificateTenants
+	// The initial settings which can be changed at runtime with Reconfigure.
+	Config Config
+	// Record every tool call in the audit log. Optional.
+	Auditor *audit.Auditor
+	// The HTTP paths of the MCP transports.
+	Transports Transports
+	// Enable stateful sessions of the streamable HTTP transport, which are kept in this store. Optional.
+	SessionStore session.Store
+	// The expiry of stateful sessions without requests. Must match the TTL of the session store.
+	SessionTTL time.Duration
+}
+
+// Transports configures the HTTP paths of the MCP transports. An empty path disables a transport.
+type Transports struct {
+	// The path of the streamable HTTP transport. The path / matches all paths which are not used by another transport.
+	StreamableHTTPPath string
+	// The base path of the legacy HTTP+SSE transport. The event stream is served at <path>/sse and the messages are posted to <path>/message.
+	SSEPath string
+}
+
+func New(logger *zap.Logger, k8sClient client.Client, tlsClient *tlsconfig.Client, opts Options) *MCPServer {
 	hooks := &server.Hooks{}
-	mcpServer := server.NewMCPServer(MCP_NAME, MCP_VERSION,
+	s := &MCPServer{
+		logger:        logger,
+		k8sClient:     k8sClient,
+		tlsClient:     tlsClient,
+		readOnly:      opts.ReadOnly,
+		apiKeys:       opts.APIKeys,
+		tokenReviewer: opts.TokenReviewer,
+		limiter:       ratelimit.New(opts.Config.RateLimits),
+		redactor:      redaction.New(opts.Config.Redaction),
+		auditor:       opts.Auditor,
+
+		transports: opts.Transports,
+
+		sessionStore: opts.SessionStore,
+		sessionTTL:   opts.SessionTTL,
+
+		serviceAccountToken: opts.ServiceAccountToken,
+		certificateTenants:  opts.CertificateTenants,
+	}
+	s.config.Store(&opts.Config)
+
+	s.mcpServer = server.NewMCPServer(MCP_NAME, MCP_VERSION,
 		server.WithToolCapabilities(true),
 		server.WithHooks(hooks),
+		server.WithToolHandlerMiddleware(s.toolCallMiddleware),
+		server.WithToolFilter(s.filterTools),
 		server.WithInstructions(`
 This server provides access to Tempo instances in a Kubernetes cluster.
 
@@ -39,47 +131,59 @@ Do not query across multiple instances unless specifically asked by the user.
 Ask the user which Tempo instance to query if the user did not specify it explicitly.
 `),
 	)
-	httpServer := server.NewStreamableHTTPServer(mcpServer, server.WithStateful(false))
-
-	s := &MCPServer{
-		logger:    logger,
-		k8sClient: k8sClient,
-		tlsConfig: tlsConfig,
-		readOnly:  readOnly,
-
-		mcpServer:  mcpServer,
-		HttpServer: httpServer,
+	if s.sessionStore != nil {
+		s.httpServer = server.NewStreamableHTTPServer(s.mcpServer, server.WithSessionIdManagerResolver(sessionIdManagerResolver{s: s}))
+		hooks.AddAfterInitialize(func(ctx context.Context, id any, request *mcp.InitializeRequest, result *mcp.InitializeResult) {
+			s.createSession(ctx, request)
+		})
+	} else {
+		s.httpServer = server.NewStreamableHTTPServer(s.mcpServer, server.WithStateful(false))
+	}
+	if opts.Transports.SSEPath != "" {
+		s.sseServer = server.NewSSEServer(s.mcpServer,
+			server.WithStaticBasePath(opts.Transports.SSEPath),
+			// Keeps the event stream open behind proxies with an idle timeout
+			server.WithKeepAlive(true),
+		)
 	}
 
 	s.registerTools()
 	hooks.OnBeforeListTools = []server.OnBeforeListToolsFunc{func(ctx context.Context, id any, request *mcp.ListToolsRequest) {
-		if !s.toolsInitialized {
-			ctx := WithAuthTokenFromHeader(ctx, request.Header)
-			err := s.registerProxiedTools(ctx)
-			if err != nil {
-				logger.Error("error listing tools from remote MCP server", zap.Error(err))
-				return
-			}
-			s.toolsInitialized = true
+		err := s.ensureProxiedTools(ctx)
+		if err != nil {
+			logging.FromContext(ctx, logger).Error("error listing tools from remote MCP server", zap.Error(err))
 		}
 	}}
 
 	// In case the MCP client does not list tools first
 	hooks.OnBeforeCallTool = []server.OnBeforeCallToolFunc{func(ctx context.Context, id any, request *mcp.CallToolRequest) {
-		if !s.toolsInitialized {
-			ctx := WithAuthTokenFromHeader(ctx, request.Header)
-			err := s.registerProxiedTools(ctx)
-			if err != nil {
-				logger.Error("error listing tools from remote MCP server", zap.Error(err))
-				return
-			}
-			s.toolsInitialized = true
+		err := s.ensureProxiedTools(ctx)
+		if err != nil {
+			logging.FromContext(ctx, logger).Error("error listing tools from remote MCP server", zap.Error(err))
 		}
 	}}
 
 	return s
 }
 
+// Handler returns the HTTP handler of all enabled MCP transports.
+// All transports share the authentication of the HTTP headers.
+func (s *MCPServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	if s.transports.StreamableHTTPPath != "" {
+		var handler http.Handler = s.httpServer
+		if s.sessionStore != nil {
+			handler = s.sessionMiddleware(handler)
+		}
+		mux.Handle(s.transports.StreamableHTTPPath, handler)
+	}
+	if s.sseServer != nil {
+		mux.Handle(s.sseServer.CompleteSsePath(), s.sseServer.SSEHandler())
+		mux.Handle(s.sseServer.CompleteMessagePath(), s.sseServer.MessageHandler())
+	}
+	return otelhttp.NewHandler(s.requestLogMiddleware(s.authMiddleware(mux)), "mcp")
+}
+
 func (s *MCPServer) registerTools() {
 	s.mcpServer.AddTool(mcp.NewTool("list-instances",
 		mcp.WithDescription("List all Tempo instances. The assistant should display the instances in a table."),
@@ -87,7 +191,6 @@ func (s *MCPServer) registerTools() {
 		mcp.WithDestructiveHintAnnotation(false),
 		mcp.WithOpenWorldHintAnnotation(false),
 	), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		ctx = WithAuthTokenFromHeader(ctx, request.Header)
 		instances, err := s.listTempoInstances(ctx)
 		if err != nil {
 			return mcp.NewToolResultError(err.Error()), nil
@@ -97,6 +200,67 @@ func (s *MCPServer) registerTools() {
 			"instances": instances,
 		}), nil
 	})
+
+	s.registerAnalysisTools()
+}
+
+// ensureProxiedTools registers the tools of the Tempo MCP server, unless they were registered already.
+func (s *MCPServer) ensureProxiedTools(ctx context.Context) error {
+	s.toolsMu.Lock()
+	defer s.toolsMu.Unlock()
+
+	if s.toolsInitialized {
+		return nil
+	}
+
+	err := s.registerProxiedTools(ctx)
+	if err != nil {
+		s.toolsErr = err
+		return err
+	}
+	s.toolsInitialized = true
+	s.toolsErr = nil
+	return nil
+}
+
+// LoadToolCatalog loads the tools of the Tempo MCP server with the service account token of the gateway,
+// and retries until the tools are loaded or the context is cancelled. It returns immediately if a client loaded the tools already.
+func (s *MCPServer) LoadToolCatalog(ctx context.Context, retryInterval time.Duration) {
+	for {
+		err := s.loadToolCatalog(ctx)
+		if err == nil {
+			return
+		}
+		s.logger.Warn("error loading the tool catalog, retrying", zap.Error(err), zap.Duration("retryInterval", retryInterval))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func (s *MCPServer) loadToolCatalog(ctx context.Context) error {
+	token, err := s.serviceAccountToken.Token()
+	if err != nil {
+		return err
+	}
+	return s.ensureProxiedTools(WithAuthToken(ctx, token))
+}
+
+// CheckToolCatalog is a readiness check which verifies that the tools of the Tempo MCP server were loaded at least once.
+func (s *MCPServer) CheckToolCatalog(ctx context.Context) error {
+	s.toolsMu.Lock()
+	defer s.toolsMu.Unlock()
+	switch {
+	case s.toolsInitialized:
+		return nil
+	case s.toolsErr != nil:
+		return fmt.Errorf("tool catalog not loaded: %w", s.toolsErr)
+	default:
+		return errors.New("tool catalog not loaded")
+	}
 }
 
 func (s *MCPServer) registerProxiedTools(ctx context.Context) error {
@@ -116,8 +280,7 @@ func (s *MCPServer) registerProxiedTools(ctx context.Context) error {
 		firstTenant = firstInstance.Tenants[0]
 	}
 
-	endpoint := firstInstance.GetMCPEndpoint(firstTenant)
-	toolsResp, err := s.listRemoteTools(ctx, endpoint)
+	toolsResp, err := s.listRemoteTools(ctx, firstInstance, firstTenant)
 	if err != nil {
 		return err
 	}
@@ -129,12 +292,67 @@ func (s *MCPServer) registerProxiedTools(ctx context.Context) error {
 }
 
 func (s *MCPServer) registerProxiedTool(tool mcp.Tool) {
-	if s.readOnly && (tool.Annotations.ReadOnlyHint == nil || !*tool.Annotations.ReadOnlyHint) {
+	tools := s.currentConfig().Tools
+	sideEffect, known := tools.Classify(tool.Name)
+	annotatedReadOnly := tool.Annotations.ReadOnlyHint != nil && *tool.Annotations.ReadOnlyHint
+	switch {
+	case !known:
+		// The tool is registered, but hidden by the tool policy unless unclassified tools are allowed
+		s.logger.Warn("the Tempo MCP server provides an unclassified tool, which is treated as a tool with side effects",
+			zap.String("tool", tool.Name), zap.Bool("allowed", tools.AllowUnclassified), zap.Bool("readOnlyHint", annotatedReadOnly))
+		sideEffect = policy.SideEffectWrite
+	case annotatedReadOnly != (sideEffect == policy.SideEffectNone):
+		s.logger.Warn("the annotation of a tool of the Tempo MCP server does not match its classification",
+			zap.String("tool", tool.Name), zap.String("sideEffect", string(sideEffect)), zap.Bool("readOnlyHint", annotatedReadOnly))
+	}
+
+	readOnly := sideEffect == policy.SideEffectNone
+	if s.readOnly && !readOnly {
 		return
 	}
+	// Clients see the classification of the gateway, not the annotation of the Tempo MCP server
+	tool.Annotations.ReadOnlyHint = &readOnly
 
 	// Add parameters to identify a Tempo instance and tenant
-	additionalParameters := []mcp.ToolOption{
+	for _, opt := range instanceParameters() {
+		opt(&tool)
+	}
+
+	s.mcpServer.AddTool(tool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, instance, tenantName, errResult := s.resolveTarget(ctx, request, toolTarget)
+		if errResult != nil {
+			return errResult, nil
+		}
+
+		args, applied, rejected := s.applyGuardrails(ctx, request, instance.String(), tenantName)
+		if rejected != nil {
+			return rejected, nil
+		}
+
+		// The query is checked with the forwarded arguments, e.g. with the start time added by the guardrails
+		warnings, rejected := s.checkQuery(ctx, request.Params.Name, args)
+		if rejected != nil {
+			return rejected, nil
+		}
+
+		ctx, done, rejected := s.startInstanceCall(ctx, instance, tenantName)
+		if rejected != nil {
+			return rejected, nil
+		}
+		defer done()
+
+		result, err := s.callRemoteTool(ctx, instance, tenantName, request.Params.Name, args)
+		s.redactor.Redact(result, request.Params.Name, args, tenantName)
+		s.truncate(ctx, result, request.Params.Name)
+		annotateResult(result, "guardrails", "Note: the query was limited by the gateway: ", applied)
+		annotateResult(result, "lintWarnings", "Note: the query has lint warnings: ", warnings)
+		return result, err
+	})
+}
+
+// instanceParameters are the parameters of the tools which query a Tempo instance.
+func instanceParameters() []mcp.ToolOption {
+	return []mcp.ToolOption{
 		mcp.WithString("tempoNamespace",
 			mcp.Required(),
 			mcp.Description("The namespace of the Tempo instance to query"),
@@ -147,74 +365,148 @@ func (s *MCPServer) registerProxiedTool(tool mcp.Tool) {
 			mcp.Description("The tenant to query. This field is only required for multi-tenant Tempo instances."),
 		),
 	}
-	for _, opt := range additionalParameters {
-		opt(&tool)
+}
+
+// targetArguments are the names of the tool arguments which identify a Tempo instance and tenant,
+// and the names of the fields of the request logger.
+type targetArguments struct {
+	namespace string
+	name      string
+	tenant    string
+
+	instanceField string
+	tenantField   string
+}
+
+var (
+	// toolTarget is the Tempo instance and tenant queried by a tool call.
+	toolTarget = targetArguments{namespace: "tempoNamespace", name: "tempoName", tenant: "tenant", instanceField: "instance", tenantField: "tenant"}
+	// compareTarget is the Tempo instance and tenant of the compared trace of diff-traces.
+	compareTarget = targetArguments{namespace: "compareTempoNamespace", name: "compareTempoName", tenant: "compareTenant", instanceField: "compareInstance", tenantField: "compareTenant"}
+)
+
+// resolveTarget returns the Tempo instance and tenant of a tool call, or a tool error result if they are invalid or not accessible.
+// The target is recorded in the tool call and in the request logger of the returned context.
+func (s *MCPServer) resolveTarget(ctx context.Context, request mcp.CallToolRequest, args targetArguments) (context.Context, tempodiscovery.TempoInstance, string, *mcp.CallToolResult) {
+	call := toolCallFromContext(ctx)
+	instance, tenantName, errResult := s.findTarget(ctx, request, args.namespace, args.name, args.tenant)
+	if errResult != nil {
+		call.invalidTarget = true
+		return ctx, instance, tenantName, errResult
 	}
 
-	s.mcpServer.AddTool(tool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		ctx = WithAuthTokenFromHeader(ctx, request.Header)
+	call.addTarget(instance.String(), tenantName)
+	ctx = logging.With(ctx, s.logger, zap.String(args.instanceField, instance.String()), zap.String(args.tenantField, tenantName))
+	return ctx, instance, tenantName, nil
+}
 
-		tempoNamespace, err := request.RequireString("tempoNamespace")
-		if err != nil {
-			return mcp.NewToolResultError(err.Error()), nil
-		}
-		if tempoNamespace == "" {
-			return mcp.NewToolResultError("tempoNamespace parameter must not be empty"), nil
-		}
+// findTarget returns the Tempo instance and tenant identified by the given tool arguments, or a tool error result if they are invalid or not accessible.
+func (s *MCPServer) findTarget(ctx context.Context, request mcp.CallToolRequest, namespaceArg string, nameArg string, tenantArg string) (tempodiscovery.TempoInstance, string, *mcp.CallToolResult) {
+	fail := func(msg string) (tempodiscovery.TempoInstance, string, *mcp.CallToolResult) {
+		return tempodiscovery.TempoInstance{}, "", mcp.NewToolResultError(msg)
+	}
 
-		tempoName, err := request.RequireString("tempoName")
-		if err != nil {
-			return mcp.NewToolResultError(err.Error()), nil
-		}
-		if tempoName == "" {
-			return mcp.NewToolResultError("tempoName parameter must not be empty"), nil
-		}
+	tempoNamespace, err := request.RequireString(namespaceArg)
+	if err != nil {
+		return fail(err.Error())
+	}
+	if tempoNamespace == "" {
+		return fail(namespaceArg + " parameter must not be empty")
+	}
 
-		instances, err := s.listTempoInstances(ctx)
-		if err != nil {
-			return mcp.NewToolResultError(err.Error()), nil
-		}
+	tempoName, err := request.RequireString(nameArg)
+	if err != nil {
+		return fail(err.Error())
+	}
+	if tempoName == "" {
+		return fail(nameArg + " parameter must not be empty")
+	}
 
-		instance, err := findInstanceByName(instances, tempoNamespace, tempoName)
-		if err != nil {
-			return mcp.NewToolResultError(err.Error()), nil
+	instances, err := s.listTempoInstances(ctx)
+	if err != nil {
+		return fail(err.Error())
+	}
+
+	instance, err := findInstanceByName(instances, tempoNamespace, tempoName)
+	if err != nil {
+		return fail(err.Error())
+	}
+
+	if !instance.MCPEnabled {
+		var specField string
+		switch instance.Kind {
+		case tempodiscovery.KindTempoStack:
+			specField = ".spec.template.queryFrontend.mcpServer.enabled"
+		case tempodiscovery.KindTempoMonolithic:
+			specField = ".spec.query.mcpServer.enabled"
 		}
 
-		if !instance.MCPEnabled {
-			var specField string
-			switch instance.Kind {
-			case tempodiscovery.KindTempoStack:
-				specField = ".spec.template.queryFrontend.mcpServer.enabled"
-			case tempodiscovery.KindTempoMonolithic:
-				specField = ".spec.query.mcpServer.enabled"
-			}
+		msg := fmt.Sprintf("the MCP server is disabled for this instance. To enable it, set the field %s to true in the %s/%s %s instance",
+			specField, instance.Namespace, instance.Name, instance.Kind)
+		return fail(msg)
+	}
 
-			msg := fmt.Sprintf("the MCP server is disabled for this instance. To enable it, set the field %s to true in the %s/%s %s instance",
-				specField, instance.Namespace, instance.Name, instance.Kind)
-			return mcp.NewToolResultError(msg), nil
+	var tenantName string
+	if instance.Multitenancy {
+		tenantName, err = request.RequireString(tenantArg)
+		if err != nil {
+			return fail(err.Error())
+		}
+		if tenantName == "" {
+			return fail(tenantArg + " parameter must not be empty")
 		}
 
-		var tenantName string
-		if instance.Multitenancy {
-			tenantName, err = request.RequireString("tenant")
-			if err != nil {
-				return mcp.NewToolResultError(err.Error()), nil
-			}
-			if tenantName == "" {
-				return mcp.NewToolResultError("tenant parameter must not be empty"), nil
-			}
+		// Callers with an API key or a client certificate query Tempo with the service account token of the gateway,
+		// therefore the tenant must be checked here and not only by the Tempo gateway
+		if identity := auth.IdentityFromContext(ctx); identity != nil && !identity.TenantAllowed(tenantName) {
+			return fail(fmt.Sprintf("tenant '%s' is not accessible", tenantName))
+		}
+		if !slices.Contains(instance.Tenants, tenantName) {
+			return fail(fmt.Sprintf("tenant '%s' of instance %s is not accessible", tenantName, instance.String()))
 		}
+	}
+	return instance, tenantName, nil
+}
 
-		endpoint := instance.GetMCPEndpoint(tenantName)
-		return s.callRemoteTool(ctx, endpoint, request.Params.Name, request.GetArguments())
+// startInstanceCall applies the tenant and instance rate limits and the tool call timeout to a call which queries a Tempo instance.
+// The identity rate limit was already applied by the tool call middleware.
+// The done function must be called when the call finished. If a limit is exceeded, a tool error result is returned.
+func (s *MCPServer) startInstanceCall(ctx context.Context, instance tempodiscovery.TempoInstance, tenant string) (context.Context, func(), *mcp.CallToolResult) {
+	release, err := s.limiter.Acquire(ratelimit.Key{
+		Tenant:   tenant,
+		Instance: instance.String(),
 	})
+	if err != nil {
+		toolCallFromContext(ctx).Outcome = OutcomeRejected
+		return ctx, nil, newLimitErrorResult(err)
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if timeout := s.currentConfig().ToolCallTimeout; timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	return ctx, func() {
+		cancel()
+		release()
+	}, nil
 }
 
 func (s *MCPServer) listTempoInstances(ctx context.Context) ([]tempodiscovery.TempoInstance, error) {
-	auth := tempodiscovery.Authentication{}
-	authToken := AuthTokenFromContext(ctx)
+	if instances, ok := s.cachedInstances(ctx); ok {
+		return instances, nil
+	}
+
+	authToken, err := downstreamToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	authentication := tempodiscovery.Authentication{}
 	if authToken != "" {
-		auth.BearerToken = authToken
+		authentication.BearerToken = authToken
+	}
+	if identity := auth.IdentityFromContext(ctx); identity != nil {
+		authentication.AllowedTenants = identity.AllowedTenants
 	}
 
 	var verbs []string
@@ -224,7 +516,50 @@ func (s *MCPServer) listTempoInstances(ctx context.Context) ([]tempodiscovery.Te
 		verbs = []string{"create", "get"}
 	}
 
-	return tempodiscovery.New(s.logger, s.k8sClient, s.tlsConfig).ListInstances(ctx, auth, verbs)
+	config := s.currentConfig()
+	if config.DiscoveryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.DiscoveryTimeout)
+		defer cancel()
+	}
+
+	instances, err := tempodiscovery.New(s.logger, s.k8sClient, s.tlsClient, config.Discovery).ListInstances(ctx, authentication, verbs)
+	if err != nil {
+		return nil, err
+	}
+	s.cacheInstances(ctx, instances)
+	return instances, nil
+}
+
+// newLimitErrorResult returns a tool error with a retry-after hint in the text and in the result metadata.
+func newLimitErrorResult(err error) *mcp.CallToolResult {
+	result := mcp.NewToolResultError(err.Error())
+
+	var limitErr *ratelimit.LimitError
+	if errors.As(err, &limitErr) {
+		result.Meta = mcp.NewMetaFromMap(map[string]any{
+			"retryAfterSeconds": int(limitErr.RetryAfter.Seconds()),
+		})
+	}
+	return result
+}
+
+// annotateResult prepends a note to the result and lists the notes in the result metadata, for example which limits were applied to the tool call.
+func annotateResult(result *mcp.CallToolResult, metaKey string, prefix string, notes []string) {
+	if result == nil || len(notes) == 0 {
+		return
+	}
+
+	note := mcp.NewTextContent(prefix + strings.Join(notes, "; ") + ".")
+	result.Content = append([]mcp.Content{note}, result.Content...)
+
+	if result.Meta == nil {
+		result.Meta = &mcp.Meta{}
+	}
+	if result.Meta.AdditionalFields == nil {
+		result.Meta.AdditionalFields = map[string]any{}
+	}
+	result.Meta.AdditionalFields[metaKey] = notes
 }
 
 func findInstanceByName(instances []tempodiscovery.TempoInstance, namespace string, name string) (tempodiscovery.TempoInstance, error) {
@@ -0,0 +1,282 @@
+package mcpserver
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/auth"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/logging"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/session"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tempodiscovery"
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"go.uber.org/zap"
+)
+
+const sessionIDPrefix = "mcp-session-"
+
+const sessionKey contextKey = "session"
+
+func withSession(ctx context.Context, sess *session.Session) context.Context {
+	return context.WithValue(ctx, sessionKey, sess)
+}
+
+// sessionFromContext returns the stateful session of the request, or nil for stateless requests.
+func sessionFromContext(ctx context.Context) *session.Session {
+	sess, _ := ctx.Value(sessionKey).(*session.Session)
+	return sess
+}
+
+// sessionMiddleware loads the stateful session of a request and stores it in the request context.
+// Sessions of other callers are treated like unknown sessions, therefore the client receives a 404 and starts a new session.
+func (s *MCPServer) sessionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(server.HeaderKeySessionID)
+		if id == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		logger := logging.FromContext(ctx, s.logger)
+		sess, err := s.sessionStore.Get(ctx, id)
+		if err != nil {
+			logger.Error("error loading session", zap.Error(err))
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if sess != nil && sess.Identity.Name != callerName(ctx) {
+			logger.Warn("rejected session of another caller", zap.String("session_owner", sess.Identity.Name))
+			sess = nil
+		}
+		// The notification stream is not validated by the streamable HTTP server
+		if sess == nil && r.Method == http.MethodGet {
+			http.Error(w, "Session terminated", http.StatusNotFound)
+			return
+		}
+
+		if sess != nil {
+			// Limit the writes to the store, the session is extended at most once per touch interval
+			if time.Since(sess.LastSeen) > s.sessionTTL/10 {
+				sess.LastSeen = time.Now()
+				err = s.sessionStore.Put(ctx, sess)
+				if err != nil {
+					logger.Error("error extending session", zap.Error(err))
+				}
+			}
+			ctx = withSession(ctx, sess)
+		}
+
+		next.ServeHTTP(w, r.WithContext(logging.With(ctx, s.logger, zap.String("session_id", id))))
+	})
+}
+
+// createSession stores a new session after the client initialized it.
+func (s *MCPServer) createSession(ctx context.Context, request *mcp.InitializeRequest) {
+	clientSession := server.ClientSessionFromContext(ctx)
+	if clientSession == nil || clientSession.SessionID() == "" {
+		return
+	}
+
+	identity := auth.Identity{Name: callerName(ctx), Method: auth.MethodBearerToken}
+	if callerIdentity := auth.IdentityFromContext(ctx); callerIdentity != nil {
+		identity = *callerIdentity
+	}
+
+	now := time.Now()
+	err := s.sessionStore.Put(ctx, &session.Session{
+		ID:        clientSession.SessionID(),
+		Identity:  identity,
+		Client:    request.Params.ClientInfo.Name,
+		CreatedAt: now,
+		LastSeen:  now,
+	})
+	if err != nil {
+		logging.FromContext(ctx, s.logger).Error("error storing session", zap.Error(err))
+	}
+}
+
+// cachedInstances returns the accessible instances cached in the session, or false if the cache expired.
+func (s *MCPServer) cachedInstances(ctx context.Context) ([]tempodiscovery.TempoInstance, bool) {
+	sess := sessionFromContext(ctx)
+	config := s.currentConfig()
+	if sess == nil || config.InstanceCacheTTL <= 0 || time.Since(sess.InstancesUpdatedAt) > config.InstanceCacheTTL {
+		return nil, false
+	}
+
+	instances := make([]tempodiscovery.TempoInstance, len(sess.Instances))
+	for i, cached := range sess.Instances {
+		instances[i] = cached.TempoInstance
+		instances[i].CABundle = cached.CABundle
+	}
+	// Instances which were disabled after they were cached are removed
+	return config.Discovery.ApplyOverrides(instances), true
+}
+
+// cacheInstances stores the accessible instances in the session.
+func (s *MCPServer) cacheInstances(ctx context.Context, instances []tempodiscovery.TempoInstance) {
+	sess := sessionFromContext(ctx)
+	if sess == nil || s.currentConfig().InstanceCacheTTL <= 0 {
+		return
+	}
+
+	sess.Instances = make([]session.Instance, len(instances))
+	for i, instance := range instances {
+		sess.Instances[i] = session.Instance{TempoInstance: instance, CABundle: instance.CABundle}
+	}
+	sess.InstancesUpdatedAt = time.Now()
+	err := s.sessionStore.Put(ctx, sess)
+	if err != nil {
+		logging.FromContext(ctx, s.logger).Error("error caching instances in session", zap.Error(err))
+	}
+}
+
+// sessionIdManagerResolver binds the session ID manager to the request, which holds the session loaded by the sessionMiddleware.
+type sessionIdManagerResolver struct {
+	s *MCPServer
+}
+
+func (r sessionIdManagerResolver) ResolveSessionIdManager(req *http.Request) server.SessionIdManager {
+	return &sessionIdManager{s: r.s, ctx: req.Context()}
+}
+
+type sessionIdManager struct {
+	s   *MCPServer
+	ctx context.Context
+}
+
+func (m *sessionIdManager) Generate() string {
+	return sessionIDPrefix + uuid.NewString()
+}
+
+// Validate reports unknown, expired and foreign sessions as terminated, therefore the client starts a new session.
+func (m *sessionIdManager) Validate(sessionID string) (bool, error) {
+	sess := sessionFromContext(m.ctx)
+	return sess == nil || sess.ID != sessionID, nil
+}
+
+func (m *sessionIdManager) Terminate(sessionID string) (bool, error) {
+	sess := sessionFromContext(m.ctx)
+	if sess == nil || sess.ID != sessionID {
+		return false, nil
+	}
+
+	for _, mcpClient := range m.s.pool.removeSession(sessionID) {
+		_ = m.s.downstream.close(mcpClient)
+	}
+	return false, m.s.sessionStore.Delete(m.ctx, sessionID)
+}
+
+// downstreamPool keeps the downstream MCP sessions of stateful sessions open between tool calls.
+// The pool is local to a replica. Downstream sessions are closed when the session is terminated or after they were idle for the session TTL.
+type downstreamPool struct {
+	mu       sync.Mutex
+	sessions map[string]map[string]*pooledClient
+}
+
+type pooledClient struct {
+	client   *client.Client
+	token    string
+	lastUsed time.Time
+}
+
+func poolKey(instance tempodiscovery.TempoInstance, tenant string) string {
+	return instance.String() + "/" + tenant
+}
+
+// get returns an open downstream client of the session, or nil if none exists for the current token.
+func (p *downstreamPool) get(sessionID string, key string, token string) *client.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pooled, ok := p.sessions[sessionID][key]
+	if !ok || pooled.token != token {
+		return nil
+	}
+	pooled.lastUsed = time.Now()
+	return pooled.client
+}
+
+// put adds a client to the pool and returns the client which it replaced, if any.
+func (p *downstreamPool) put(sessionID string, key string, token string, mcpClient *client.Client) *client.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sessions == nil {
+		p.sessions = map[string]map[string]*pooledClient{}
+	}
+	if p.sessions[sessionID] == nil {
+		p.sessions[sessionID] = map[string]*pooledClient{}
+	}
+
+	var replaced *client.Client
+	if old, ok := p.sessions[sessionID][key]; ok {
+		replaced = old.client
+	}
+	p.sessions[sessionID][key] = &pooledClient{client: mcpClient, token: token, lastUsed: time.Now()}
+	return replaced
+}
+
+// remove removes the client from the pool, for example after a failed tool call.
+func (p *downstreamPool) remove(sessionID string, key string, mcpClient *client.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pooled, ok := p.sessions[sessionID][key]; ok && pooled.client == mcpClient {
+		delete(p.sessions[sessionID], key)
+	}
+}
+
+// removeSession removes all clients of the session from the pool and returns them.
+func (p *downstreamPool) removeSession(sessionID string) []*client.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var clients []*client.Client
+	for _, pooled := range p.sessions[sessionID] {
+		clients = append(clients, pooled.client)
+	}
+	delete(p.sessions, sessionID)
+	return clients
+}
+
+// removeIdle removes the clients which were not used within the idle duration from the pool and returns them.
+func (p *downstreamPool) removeIdle(idle time.Duration) []*client.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var clients []*client.Client
+	for sessionID, pooled := range p.sessions {
+		for key, c := range pooled {
+			if time.Since(c.lastUsed) > idle {
+				clients = append(clients, c.client)
+				delete(pooled, key)
+			}
+		}
+		if len(pooled) == 0 {
+			delete(p.sessions, sessionID)
+		}
+	}
+	return clients
+}
+
+// RunSessions closes idle downstream sessions periodically until the context is cancelled.
+func (s *MCPServer) RunSessions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, mcpClient := range s.pool.removeIdle(s.sessionTTL) {
+				_ = s.downstream.close(mcpClient)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package mcpserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/client"
+)
+
+// callTracker counts the tool calls in progress and rejects new calls after it was closed.
+type callTracker struct {
+	mu     sync.Mutex
+	closed bool
+	active int
+	idle   chan struct{}
+}
+
+// start registers a new tool call. It returns false if the tracker is closed.
+func (t *callTracker) start() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return false
+	}
+	t.active++
+	return true
+}
+
+func (t *callTracker) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.active--
+	if t.closed && t.active == 0 {
+		close(t.idle)
+	}
+}
+
+// close rejects new tool calls and returns a channel which is closed once all tool calls finished.
+func (t *callTracker) close() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.closed {
+		t.closed = true
+		t.idle = make(chan struct{})
+		if t.active == 0 {
+			close(t.idle)
+		}
+	}
+	return t.idle
+}
+
+func (t *callTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.active
+}
+
+// downstreamClients holds the open MCP clients to Tempo instances and their HTTP transports.
+type downstreamClients struct {
+	mu      sync.Mutex
+	clients map[*client.Client]*http.Transport
+}
+
+func (d *downstreamClients) add(mcpClient *client.Client, transport *http.Transport) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.clients == nil {
+		d.clients = map[*client.Client]*http.Transport{}
+	}
+	d.clients[mcpClient] = transport
+}
+
+// close closes the MCP client and the idle connections of its HTTP transport.
+func (d *downstreamClients) close(mcpClient *client.Client) error {
+	d.mu.Lock()
+	transport, ok := d.clients[mcpClient]
+	delete(d.clients, mcpClient)
+	d.mu.Unlock()
+
+	err := mcpClient.Close()
+	if ok {
+		transport.CloseIdleConnections()
+	}
+	return err
+}
+
+func (d *downstreamClients) closeAll() {
+	d.mu.Lock()
+	clients := make([]*client.Client, 0, len(d.clients))
+	for mcpClient := range d.clients {
+		clients = append(clients, mcpClient)
+	}
+	d.mu.Unlock()
+
+	for _, mcpClient := range clients {
+		_ = d.close(mcpClient)
+	}
+}
+
+// Shutdown rejects new tool calls and waits until the tool calls in progress finished or the context is done.
+// Afterwards, all downstream MCP clients are closed, which aborts the remaining tool calls.
+func (s *MCPServer) Shutdown(ctx context.Context) error {
+	var err error
+	select {
+	case <-s.calls.close():
+		s.logger.Info("all tool calls finished")
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out waiting for %d tool calls to finish", s.calls.count())
+	}
+
+	s.downstream.closeAll()
+	return err
+}
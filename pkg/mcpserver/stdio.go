@@ -0,0 +1,24 @@
+package mcpserver
+
+import (
+	"context"
+	"io"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/auth"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/logging"
+	"github.com/mark3labs/mcp-go/server"
+	"go.uber.org/zap"
+)
+
+// ServeStdio serves the MCP server on stdin and stdout until stdin is closed or the context is cancelled.
+// A stdio server has a single client, therefore all requests use the same identity, and the downstream token is read from the token source.
+func (s *MCPServer) ServeStdio(ctx context.Context, identity *auth.Identity, tokens auth.TokenSource, stdin io.Reader, stdout io.Writer) error {
+	stdioServer := server.NewStdioServer(s.mcpServer)
+	stdioServer.SetErrorLogger(zap.NewStdLog(s.logger))
+	stdioServer.SetContextFunc(func(ctx context.Context) context.Context {
+		ctx = auth.WithIdentity(ctx, identity)
+		ctx = WithTokenSource(ctx, tokens)
+		return logging.With(ctx, s.logger, zap.String("identity", identity.Name))
+	})
+	return stdioServer.Listen(ctx, stdin, stdout)
+}
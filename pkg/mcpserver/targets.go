@@ -0,0 +1,113 @@
+package mcpserver
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/logging"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tempodiscovery"
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.uber.org/zap"
+)
+
+// targets are the Tempo instances and tenants which a caller can query with the tools.
+type targets struct {
+	namespaces []string
+	names      []string
+	tenants    []string
+	// One line per instance, for example "tracing/simplest (tenants: dev, prod)".
+	descriptions []string
+}
+
+func newTargets(instances []tempodiscovery.TempoInstance) targets {
+	var t targets
+	for _, instance := range instances {
+		if !instance.MCPEnabled {
+			continue
+		}
+
+		t.namespaces = append(t.namespaces, instance.Namespace)
+		t.names = append(t.names, instance.Name)
+		t.tenants = append(t.tenants, instance.Tenants...)
+		if len(instance.Tenants) > 0 {
+			t.descriptions = append(t.descriptions, fmt.Sprintf("%s (tenants: %s)", instance.String(), strings.Join(instance.Tenants, ", ")))
+		} else {
+			t.descriptions = append(t.descriptions, instance.String())
+		}
+	}
+
+	slices.Sort(t.namespaces)
+	t.namespaces = slices.Compact(t.namespaces)
+	slices.Sort(t.names)
+	t.names = slices.Compact(t.names)
+	slices.Sort(t.tenants)
+	t.tenants = slices.Compact(t.tenants)
+	return t
+}
+
+// queriesInstances returns true if the tool targets a Tempo instance.
+func queriesInstances(tool mcp.Tool) bool {
+	_, ok := tool.InputSchema.Properties["tempoName"]
+	return ok
+}
+
+// filterToolsByTargets hides the tools which target a Tempo instance if the caller cannot query any instance,
+// and restricts the instance and tenant parameters of the remaining tools to the instances and tenants of the caller.
+func (s *MCPServer) filterToolsByTargets(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+	if !slices.ContainsFunc(tools, queriesInstances) {
+		return tools
+	}
+
+	instances, err := s.listTempoInstances(ctx)
+	if err != nil {
+		// Calls are validated against the accessible instances anyway, therefore the tools are listed unchanged
+		logging.FromContext(ctx, s.logger).Warn("error listing Tempo instances for tools/list", zap.Error(err))
+		return tools
+	}
+
+	t := newTargets(instances)
+	filtered := make([]mcp.Tool, 0, len(tools))
+	for _, tool := range tools {
+		if !queriesInstances(tool) {
+			filtered = append(filtered, tool)
+			continue
+		}
+		if len(t.names) == 0 {
+			continue
+		}
+		filtered = append(filtered, withTargets(tool, t))
+	}
+	return filtered
+}
+
+// withTargets returns a copy of the tool with enums and descriptions of the accessible instances and tenants.
+func withTargets(tool mcp.Tool, t targets) mcp.Tool {
+	properties := maps.Clone(tool.InputSchema.Properties)
+	instancesDescription := "Accessible instances: " + strings.Join(t.descriptions, "; ")
+
+	setProperty := func(name string, enum []string, description string) {
+		property, ok := properties[name].(map[string]any)
+		if !ok {
+			return
+		}
+		property = maps.Clone(property)
+		if len(enum) > 0 {
+			property["enum"] = enum
+		}
+		property["description"] = description
+		properties[name] = property
+	}
+	setProperty("tempoNamespace", t.namespaces, "The namespace of the Tempo instance to query. "+instancesDescription)
+	setProperty("tempoName", t.names, "The name of the Tempo instance to query. "+instancesDescription)
+	if len(t.tenants) > 0 {
+		setProperty("tenant", t.tenants, "The tenant to query. This field is only required for multi-tenant Tempo instances. "+instancesDescription)
+	} else {
+		setProperty("tenant", nil, "The tenant to query. None of the accessible instances are multi-tenant, therefore this field is not required.")
+	}
+
+	tool.InputSchema.Properties = properties
+	return tool
+}
@@ -0,0 +1,88 @@
+package mcpserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tempodiscovery"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/traces"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxTraceBytes limits the size of a trace fetched from the Tempo API.
+const maxTraceBytes = 64 << 20
+
+var traceIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{1,32}$`)
+
+// fetchTrace fetches a trace from the Tempo HTTP API of an instance, redacts it and parses it.
+func (s *MCPServer) fetchTrace(ctx context.Context, instance tempodiscovery.TempoInstance, tenant string, traceID string) (_ *traces.Trace, err error) {
+	if !traceIDPattern.MatchString(traceID) {
+		return nil, fmt.Errorf("invalid trace ID '%s', expected up to 32 hex characters", traceID)
+	}
+
+	ctx, span := tracing.Tracer.Start(ctx, "downstream GET /api/v2/traces", trace.WithAttributes(
+		attribute.String("tempo.instance", instance.String()),
+		attribute.String("tempo.tenant", tenant),
+	))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	tlsConfig, err := s.tlsClient.Config(ctx, instance.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	authToken, err := downstreamToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, instance.GetEndpoint(tenant)+"/api/v2/traces/"+url.PathEscape(traceID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+authToken)
+	}
+
+	roundTripper := &http.Transport{TLSClientConfig: tlsConfig}
+	defer roundTripper.CloseIdleConnections()
+	httpClient := &http.Client{Transport: otelhttp.NewTransport(roundTripper)}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch trace: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxTraceBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trace: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("trace %s not found", traceID)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("failed to fetch trace: Tempo returned %s: %s", resp.Status, shortenBody(body))
+	case len(body) > maxTraceBytes:
+		return nil, fmt.Errorf("the trace exceeds %d MiB", maxTraceBytes>>20)
+	}
+
+	// Sensitive span data never reaches the analysis or the caller
+	redacted := s.redactor.RedactText(string(body), tenant)
+	return traces.Parse([]byte(redacted))
+}
+
+func shortenBody(body []byte) string {
+	const maxLength = 200
+	if len(body) > maxLength {
+		return string(body[:maxLength]) + "..."
+	}
+	return string(body)
+}
@@ -0,0 +1,223 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/audit"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/auth"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/logging"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/metrics"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/ratelimit"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tracing"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const toolCallKey contextKey = "toolCall"
+
+type OutcomeType string
+
+const (
+	OutcomeSuccess   OutcomeType = "success"
+	OutcomeToolError OutcomeType = "tool_error"
+	OutcomeError     OutcomeType = "error"
+	OutcomeRejected  OutcomeType = "rejected"
+)
+
+// The instance and tenant labels of tool calls with an invalid target, and of tool calls which were rejected before their target was validated.
+const (
+	labelInvalid = "invalid"
+	labelUnknown = "unknown"
+)
+
+// toolCall holds information about a tool call.
+// The tool handler fills in the target instance and tenant after they were validated.
+type toolCall struct {
+	Instance string
+	Tenant   string
+	// All validated targets, if the tool call queries more than one Tempo instance or tenant, e.g. diff-traces.
+	Targets []audit.Target
+	// Overrides the outcome derived from the tool result, for example if the call was rejected by a limit.
+	Outcome OutcomeType
+
+	invalidTarget bool
+}
+
+func withToolCall(ctx context.Context) (context.Context, *toolCall) {
+	call := &toolCall{}
+	return context.WithValue(ctx, toolCallKey, call), call
+}
+
+// toolCallFromContext returns the information about the current tool call.
+// Outside of a tool call, a detached struct is returned, therefore callers can always set fields.
+func toolCallFromContext(ctx context.Context) *toolCall {
+	call, ok := ctx.Value(toolCallKey).(*toolCall)
+	if !ok {
+		return &toolCall{}
+	}
+	return call
+}
+
+// addTarget records a validated target. The first target is the target of the metrics and logs of the tool call.
+func (c *toolCall) addTarget(instance string, tenant string) {
+	if len(c.Targets) == 0 {
+		c.Instance = instance
+		c.Tenant = tenant
+	}
+	c.Targets = append(c.Targets, audit.Target{Instance: instance, Tenant: tenant})
+}
+
+// metricLabels returns the instance and tenant labels of the metrics of a tool call.
+// Only validated targets are used as labels, therefore callers cannot create arbitrary series.
+func (c *toolCall) metricLabels(outcome OutcomeType) (string, string) {
+	switch {
+	case c.invalidTarget:
+		return labelInvalid, labelInvalid
+	case c.Instance == "" && outcome == OutcomeRejected:
+		return labelUnknown, labelUnknown
+	default:
+		return c.Instance, c.Tenant
+	}
+}
+
+func (c *toolCall) outcome(result *mcp.CallToolResult, err error) OutcomeType {
+	switch {
+	case c.Outcome != "":
+		return c.Outcome
+	case err != nil:
+		return OutcomeError
+	case result != nil && result.IsError:
+		return OutcomeToolError
+	default:
+		return OutcomeSuccess
+	}
+}
+
+// toolCallAllowed returns true if the tool policy allows the caller to call the tool.
+func (s *MCPServer) toolCallAllowed(ctx context.Context, name string) bool {
+	serverTool := s.mcpServer.GetTool(name)
+	if serverTool == nil {
+		return false
+	}
+	return s.toolAllowed(ctx, serverTool.Tool)
+}
+
+// toolCallMiddleware traces tool calls, records their count, latency and concurrency, applies the identity rate limit and writes the audit log.
+func (s *MCPServer) toolCallMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, call := withToolCall(ctx)
+		tool := request.Params.Name
+
+		ctx, span := tracing.Tracer.Start(ctx, "tools/call "+tool, trace.WithAttributes(
+			attribute.String("mcp.tool.name", tool),
+		))
+
+		inFlight := metrics.ToolCallsInFlight.WithLabelValues(tool)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		var result *mcp.CallToolResult
+		var err error
+		start := time.Now()
+		switch {
+		case !s.toolCallAllowed(ctx, tool):
+			call.Outcome = OutcomeRejected
+			result = mcp.NewToolResultError(fmt.Sprintf("the tool '%s' is not allowed", tool))
+		case s.calls.start():
+			result, err = func() (*mcp.CallToolResult, error) {
+				defer s.calls.done()
+
+				// The identity limit applies to every tool call, before the discovery of the Tempo instances
+				release, err := s.limiter.Acquire(ratelimit.Key{Identity: callerName(ctx)})
+				if err != nil {
+					call.Outcome = OutcomeRejected
+					return newLimitErrorResult(err), nil
+				}
+				defer release()
+
+				return next(ctx, request)
+			}()
+		default:
+			call.Outcome = OutcomeRejected
+			result = mcp.NewToolResultError("the gateway is shutting down, retry the tool call")
+		}
+		duration := time.Since(start)
+
+		outcome := call.outcome(result, err)
+		instanceLabel, tenantLabel := call.metricLabels(outcome)
+		metrics.ToolCalls.WithLabelValues(tool, instanceLabel, tenantLabel, string(outcome)).Inc()
+		metrics.ToolCallDuration.WithLabelValues(tool, instanceLabel, tenantLabel, string(outcome)).Observe(duration.Seconds())
+
+		span.SetAttributes(
+			attribute.String("tempo.instance", call.Instance),
+			attribute.String("tempo.tenant", call.Tenant),
+			attribute.String("mcp.tool.outcome", string(outcome)),
+		)
+		if outcome != OutcomeSuccess && err == nil {
+			span.SetStatus(codes.Error, string(outcome))
+		}
+		tracing.EndSpan(span, err)
+
+		fields := []zap.Field{
+			zap.String("instance", call.Instance),
+			zap.String("tenant", call.Tenant),
+			zap.String("outcome", string(outcome)),
+			zap.Duration("duration", duration),
+		}
+		if len(call.Targets) > 1 {
+			fields = append(fields, zap.Any("targets", call.Targets))
+		}
+		logging.FromContext(ctx, s.logger).Debug("tool call finished", fields...)
+
+		if s.auditor != nil && s.auditor.Enabled() {
+			s.auditor.Record(ctx, newAuditEvent(ctx, request, call, result, err, outcome, start, duration))
+		}
+
+		return result, err
+	}
+}
+
+func newAuditEvent(ctx context.Context, request mcp.CallToolRequest, call *toolCall, result *mcp.CallToolResult, err error,
+	outcome OutcomeType, start time.Time, duration time.Duration) audit.Event {
+	event := audit.Event{
+		Timestamp:  start.UTC(),
+		Identity:   callerName(ctx),
+		AuthMethod: string(auth.MethodBearerToken),
+		Tool:       request.Params.Name,
+		Instance:   call.Instance,
+		Tenant:     call.Tenant,
+		Arguments:  request.GetArguments(),
+		DurationMs: duration.Milliseconds(),
+		Outcome:    string(outcome),
+	}
+
+	if len(call.Targets) > 1 {
+		event.Targets = call.Targets
+	}
+	if identity := auth.IdentityFromContext(ctx); identity != nil {
+		event.AuthMethod = string(identity.Method)
+		event.Groups = identity.Groups
+	}
+	if result != nil {
+		data, marshalErr := json.Marshal(result)
+		if marshalErr == nil {
+			event.ResultSize = len(data)
+		}
+		if result.IsError && len(result.Content) > 0 {
+			if text, ok := result.Content[0].(mcp.TextContent); ok {
+				event.Error = text.Text
+			}
+		}
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	return event
+}
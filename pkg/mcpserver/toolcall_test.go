@@ -0,0 +1,29 @@
+package mcpserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/audit"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditEventTargets(t *testing.T) {
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "diff-traces"
+
+	call := &toolCall{}
+	call.addTarget("tracing/prod", "team-a")
+	event := newAuditEvent(context.Background(), request, call, mcp.NewToolResultText("ok"), nil, OutcomeSuccess, time.Now(), time.Second)
+	require.Equal(t, "tracing/prod", event.Instance)
+	require.Equal(t, "team-a", event.Tenant)
+	require.Nil(t, event.Targets)
+
+	call.addTarget("tracing/dev", "team-b")
+	event = newAuditEvent(context.Background(), request, call, mcp.NewToolResultText("ok"), nil, OutcomeSuccess, time.Now(), time.Second)
+	require.Equal(t, "tracing/prod", event.Instance)
+	require.Equal(t, "team-a", event.Tenant)
+	require.Equal(t, []audit.Target{{Instance: "tracing/prod", Tenant: "team-a"}, {Instance: "tracing/dev", Tenant: "team-b"}}, event.Targets)
+}
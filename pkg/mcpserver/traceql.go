@@ -0,0 +1,44 @@
+package mcpserver
+
+import (
+	"context"
+	"errors"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/logging"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/traceql"
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.uber.org/zap"
+)
+
+// checkQuery validates the TraceQL query of the arguments of a tool call before they are forwarded to Tempo.
+// It returns the lint warnings, or a tool error result if the query is invalid or rejected by a lint.
+func (s *MCPServer) checkQuery(ctx context.Context, tool string, args map[string]any) ([]string, *mcp.CallToolResult) {
+	warnings, err := s.currentConfig().TraceQL.Check(tool, args)
+	if err != nil {
+		toolCallFromContext(ctx).Outcome = OutcomeRejected
+		result := mcp.NewToolResultError(err.Error())
+
+		var syntaxErr *traceql.SyntaxError
+		var lintErr *traceql.LintError
+		switch {
+		case errors.As(err, &syntaxErr):
+			result.Meta = mcp.NewMetaFromMap(map[string]any{
+				"syntaxError": map[string]any{
+					"line":   syntaxErr.Pos.Line,
+					"column": syntaxErr.Pos.Column,
+					"fix":    syntaxErr.Fix,
+				},
+			})
+		case errors.As(err, &lintErr):
+			result.Meta = mcp.NewMetaFromMap(map[string]any{
+				"lint": lintErr.Lint,
+			})
+		}
+		return nil, result
+	}
+
+	if len(warnings) > 0 {
+		logging.FromContext(ctx, s.logger).Debug("query has lint warnings", zap.Strings("warnings", warnings))
+	}
+	return warnings, nil
+}
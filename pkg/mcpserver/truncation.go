@@ -0,0 +1,31 @@
+package mcpserver
+
+import (
+	"context"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/logging"
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.uber.org/zap"
+)
+
+// truncate reduces the result to the size limit of the tool, and tells the caller what was omitted.
+func (s *MCPServer) truncate(ctx context.Context, result *mcp.CallToolResult, tool string) {
+	t := s.currentConfig().Truncation.Truncate(result, tool)
+	if t == nil {
+		return
+	}
+
+	logging.FromContext(ctx, s.logger).Debug("truncated tool result",
+		zap.Int("original_bytes", t.OriginalBytes),
+		zap.Int("bytes", t.Bytes),
+		zap.Strings("omitted", t.Omitted),
+	)
+
+	annotateResult(result, "truncation", "Note: ", []string{t.Note()})
+	result.Meta.AdditionalFields["truncation"] = map[string]any{
+		"originalBytes": t.OriginalBytes,
+		"bytes":         t.Bytes,
+		"omitted":       t.Omitted,
+		"hint":          t.Hint,
+	}
+}
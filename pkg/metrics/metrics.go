@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "tempo_mcp_gateway"
+
+// All labels have a bounded set of values: tool names are limited to the registered tools,
+// instance and tenant names are limited to the Tempo instances in the cluster and are only set after they were validated
+// against the instances and tenants accessible to the caller. Tool calls with an invalid target are labeled "invalid",
+// tool calls which were rejected before their target was validated are labeled "unknown".
+var (
+	Registry = prometheus.NewRegistry()
+
+	ToolCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tool_calls_total",
+		Help:      "Total number of tool calls, by tool, instance, tenant and outcome.",
+	}, []string{"tool", "instance", "tenant", "outcome"})
+	ToolCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tool_call_duration_seconds",
+		Help:      "Duration of tool calls, by tool, instance, tenant and outcome.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"tool", "instance", "tenant", "outcome"})
+	ToolCallsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tool_calls_inflight",
+		Help:      "Current number of tool calls in progress, by tool.",
+	}, []string{"tool"})
+
+	DiscoveryDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "discovery_duration_seconds",
+		Help:      "Duration of the discovery of Tempo instances, including access probes.",
+		Buckets:   prometheus.DefBuckets,
+	})
+	AccessProbes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "access_probes_total",
+		Help:      "Total number of tenant access probes, by result.",
+	}, []string{"result"})
+	DownstreamInitializeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "downstream_initialize_duration_seconds",
+		Help:      "Duration of the MCP initialize handshake with the Tempo MCP server, by outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"outcome"})
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Total number of cache lookups, by cache and result (hit or miss).",
+	}, []string{"cache", "result"})
+
+	RateLimitInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ratelimit_inflight_calls",
+		Help:      "Current number of tool calls holding a concurrency slot, by limit scope.",
+	}, []string{"scope"})
+	RateLimitTrackedKeys = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ratelimit_tracked_keys",
+		Help:      "Current number of identities, tenants or instances with limiter state, by limit scope.",
+	}, []string{"scope"})
+	RateLimitRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ratelimit_rejections_total",
+		Help:      "Total number of tool calls rejected by a limit, by limit scope and reason.",
+	}, []string{"scope", "reason"})
+
+	AuditErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "audit_errors_total",
+		Help:      "Total number of audit events which could not be written, by sink.",
+	}, []string{"sink"})
+
+	ConfigReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "config_reloads_total",
+		Help:      "Total number of configuration file loads, by result (success or failure).",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+
+		ToolCalls,
+		ToolCallDuration,
+		ToolCallsInFlight,
+
+		DiscoveryDuration,
+		AccessProbes,
+		DownstreamInitializeDuration,
+		CacheRequests,
+
+		RateLimitInFlight,
+		RateLimitTrackedKeys,
+		RateLimitRejections,
+
+		AuditErrors,
+
+		ConfigReloads,
+	)
+}
+
+// CacheLookup records a cache hit or miss.
+func CacheLookup(cache string, hit bool) {
+	if hit {
+		CacheRequests.WithLabelValues(cache, "hit").Inc()
+	} else {
+		CacheRequests.WithLabelValues(cache, "miss").Inc()
+	}
+}
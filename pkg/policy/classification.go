@@ -0,0 +1,58 @@
+package policy
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// SideEffectType classifies the side effects of a tool.
+type SideEffectType string
+
+const (
+	// The tool only reads data.
+	SideEffectNone SideEffectType = "none"
+	// The tool modifies data or has other side effects.
+	SideEffectWrite SideEffectType = "write"
+)
+
+// KnownTools is the built-in classification of the tools of the gateway and of the Tempo MCP server.
+// The classification is maintained by the gateway, because the annotations reported by the Tempo MCP server are not trusted.
+var KnownTools = map[string]SideEffectType{
+	// Tools of the gateway
+	"list-instances":  SideEffectNone,
+	"summarize-trace": SideEffectNone,
+	"critical-path":   SideEffectNone,
+	"diff-traces":     SideEffectNone,
+
+	// Tools of the Tempo MCP server
+	"traceql-search":          SideEffectNone,
+	"traceql-metrics-instant": SideEffectNone,
+	"traceql-metrics-range":   SideEffectNone,
+	"get-trace":               SideEffectNone,
+	"get-attribute-names":     SideEffectNone,
+	"get-attribute-values":    SideEffectNone,
+	"docs-traceql":            SideEffectNone,
+}
+
+// Classify returns the side effects of a tool, or false if the tool is not classified.
+// The configured classification takes precedence over the built-in classification.
+func (c Config) Classify(tool string) (SideEffectType, bool) {
+	if sideEffect, ok := c.Classification[tool]; ok {
+		return sideEffect, true
+	}
+	sideEffect, ok := KnownTools[tool]
+	return sideEffect, ok
+}
+
+func (c Config) validateClassification() []error {
+	var errs []error
+	for _, tool := range slices.Sorted(maps.Keys(c.Classification)) {
+		switch c.Classification[tool] {
+		case SideEffectNone, SideEffectWrite:
+		default:
+			errs = append(errs, fmt.Errorf("classification[%s]: invalid side effect %q, expected %s or %s", tool, c.Classification[tool], SideEffectNone, SideEffectWrite))
+		}
+	}
+	return errs
+}
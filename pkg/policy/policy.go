@@ -0,0 +1,100 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+)
+
+// Config decides which tools a caller may list and call.
+// Tool names are matched with glob patterns, for example "*" or "get-*".
+type Config struct {
+	Rules `json:",inline"`
+	// Rules for specific identities and groups, replacing the default rules.
+	// The first override which matches the identity or one of its groups applies.
+	Overrides []Override `json:"overrides,omitempty"`
+	// Side effects of tools, which add to and override the built-in classification.
+	Classification map[string]SideEffectType `json:"classification,omitempty"`
+	// Allow tools which are not classified. Unclassified tools are treated as tools with side effects.
+	AllowUnclassified bool `json:"allowUnclassified,omitempty"`
+}
+
+type Rules struct {
+	// Only allow tools matching these patterns. All tools are allowed if empty.
+	Allow []string `json:"allow,omitempty"`
+	// Deny tools matching these patterns. Deny patterns take precedence over allow patterns.
+	Deny []string `json:"deny,omitempty"`
+	// Only allow readonly tools.
+	ReadOnly bool `json:"readOnly,omitempty"`
+}
+
+type Override struct {
+	Identities []string `json:"identities,omitempty"`
+	Groups     []string `json:"groups,omitempty"`
+	Rules      `json:",inline"`
+}
+
+// Validate checks the tool patterns and returns all errors, prefixed with the path of the invalid field.
+func (c Config) Validate() error {
+	var errs []error
+	errs = append(errs, c.Rules.validate("")...)
+	for i, override := range c.Overrides {
+		prefix := fmt.Sprintf("overrides[%d].", i)
+		if len(override.Identities) == 0 && len(override.Groups) == 0 {
+			errs = append(errs, fmt.Errorf("overrides[%d]: identities or groups must be set", i))
+		}
+		errs = append(errs, override.Rules.validate(prefix)...)
+	}
+	errs = append(errs, c.validateClassification()...)
+	return errors.Join(errs...)
+}
+
+func (r Rules) validate(prefix string) []error {
+	var errs []error
+	check := func(field string, patterns []string) {
+		for i, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+				errs = append(errs, fmt.Errorf("%s%s[%d]: invalid pattern %q", prefix, field, i, pattern))
+			}
+		}
+	}
+	check("allow", r.Allow)
+	check("deny", r.Deny)
+	return errs
+}
+
+// RulesFor returns the rules of the first override which matches the identity or one of its groups, or the default rules.
+func (c Config) RulesFor(identity string, groups []string) Rules {
+	for _, override := range c.Overrides {
+		if slices.Contains(override.Identities, identity) {
+			return override.Rules
+		}
+		for _, group := range groups {
+			if slices.Contains(override.Groups, group) {
+				return override.Rules
+			}
+		}
+	}
+	return c.Rules
+}
+
+// Allowed returns true if the rules allow the tool. Tools which only read data are allowed by readonly rules.
+func (r Rules) Allowed(tool string, readOnly bool) bool {
+	if r.ReadOnly && !readOnly {
+		return false
+	}
+	if matchAny(r.Deny, tool) {
+		return false
+	}
+	return len(r.Allow) == 0 || matchAny(r.Allow, tool)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,296 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/metrics"
+	"golang.org/x/time/rate"
+)
+
+// Limiter state of identities, tenants or instances which were not used for this duration is removed.
+const idleTimeout = 10 * time.Minute
+
+type ScopeType string
+
+const (
+	ScopeIdentity ScopeType = "identity"
+	ScopeTenant   ScopeType = "tenant"
+	ScopeInstance ScopeType = "instance"
+)
+
+type ReasonType string
+
+const (
+	ReasonRateLimit   ReasonType = "rate_limit"
+	ReasonMaxInFlight ReasonType = "max_inflight"
+)
+
+// Limit configures a token bucket rate limit and a concurrency cap. Zero values disable the respective limit.
+type Limit struct {
+	// Sustained rate of tool calls per second.
+	RPS float64 `json:"rps,omitempty"`
+	// Maximum number of tool calls in a burst. Defaults to 1 if a rate is set.
+	Burst int `json:"burst,omitempty"`
+	// Maximum number of concurrent tool calls.
+	MaxInFlight int `json:"maxInFlight,omitempty"`
+}
+
+type Config struct {
+	// Default limits for every identity, tenant and instance.
+	Identity Limit `json:"identity,omitempty"`
+	Tenant   Limit `json:"tenant,omitempty"`
+	Instance Limit `json:"instance,omitempty"`
+	// Limits for specific identities, tenants and instances (<namespace>/<name>), replacing the defaults.
+	Overrides Overrides `json:"overrides,omitempty"`
+}
+
+type Overrides struct {
+	Identities map[string]Limit `json:"identities,omitempty"`
+	Tenants    map[string]Limit `json:"tenants,omitempty"`
+	Instances  map[string]Limit `json:"instances,omitempty"`
+}
+
+// Key identifies the identity, tenant and instance of a tool call.
+// Empty fields are not limited, for example the tenant of a single-tenant instance.
+type Key struct {
+	Identity string
+	Tenant   string
+	Instance string
+}
+
+// LimitError is returned if a tool call exceeds a limit.
+type LimitError struct {
+	Scope      ScopeType
+	Key        string
+	Reason     ReasonType
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	switch e.Reason {
+	case ReasonMaxInFlight:
+		return fmt.Sprintf("too many concurrent tool calls for %s '%s', retry after %s", e.Scope, e.Key, e.RetryAfter)
+	default:
+		return fmt.Sprintf("rate limit exceeded for %s '%s', retry after %s", e.Scope, e.Key, e.RetryAfter)
+	}
+}
+
+type Limiter struct {
+	mu        sync.Mutex
+	config    Config
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+}
+
+type bucketKey struct {
+	scope ScopeType
+	key   string
+}
+
+type bucket struct {
+	scope    ScopeType
+	limit    Limit
+	rate     *rate.Limiter
+	inFlight int
+	lastUsed time.Time
+}
+
+func New(config Config) *Limiter {
+	return &Limiter{
+		config:    config,
+		buckets:   map[bucketKey]*bucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+// SetConfig replaces the limits. Limiters whose limit did not change keep their state,
+// therefore reloading the configuration does not grant a new burst.
+func (l *Limiter) SetConfig(config Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.config = config
+	for k, b := range l.buckets {
+		limit := l.limitFor(k)
+		if limit == b.limit {
+			continue
+		}
+		if limit.RPS <= 0 && limit.MaxInFlight <= 0 && b.inFlight == 0 {
+			delete(l.buckets, k)
+			continue
+		}
+		b.limit = limit
+		b.rate = updateRateLimiter(b.rate, limit)
+	}
+	l.updateTrackedKeys()
+}
+
+// Acquire checks all limits of a tool call.
+// If the call is allowed, the returned release function must be called when the tool call finished.
+// Otherwise a *LimitError is returned.
+func (l *Limiter) Acquire(key Key) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > idleTimeout {
+		l.sweep(now)
+	}
+
+	keys := []bucketKey{
+		{scope: ScopeIdentity, key: key.Identity},
+		{scope: ScopeTenant, key: key.Tenant},
+		{scope: ScopeInstance, key: key.Instance},
+	}
+
+	acquired := []*bucket{}
+	reservations := []*rate.Reservation{}
+	rollback := func() {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+		for _, b := range acquired {
+			b.inFlight--
+		}
+	}
+
+	for _, k := range keys {
+		if k.key == "" {
+			continue
+		}
+
+		limit := l.limitFor(k)
+		if limit.RPS <= 0 && limit.MaxInFlight <= 0 {
+			continue
+		}
+
+		b := l.bucket(k, limit)
+		b.lastUsed = now
+
+		if limit.MaxInFlight > 0 && b.inFlight >= limit.MaxInFlight {
+			rollback()
+			metrics.RateLimitRejections.WithLabelValues(string(k.scope), string(ReasonMaxInFlight)).Inc()
+			return nil, &LimitError{Scope: k.scope, Key: k.key, Reason: ReasonMaxInFlight, RetryAfter: time.Second}
+		}
+
+		if b.rate != nil {
+			r := b.rate.ReserveN(now, 1)
+			delay := r.DelayFrom(now)
+			if !r.OK() || delay > 0 {
+				r.CancelAt(now)
+				rollback()
+				metrics.RateLimitRejections.WithLabelValues(string(k.scope), string(ReasonRateLimit)).Inc()
+				return nil, &LimitError{Scope: k.scope, Key: k.key, Reason: ReasonRateLimit, RetryAfter: roundUp(delay)}
+			}
+			reservations = append(reservations, r)
+		}
+
+		b.inFlight++
+		acquired = append(acquired, b)
+	}
+
+	for _, b := range acquired {
+		metrics.RateLimitInFlight.WithLabelValues(string(b.scope)).Inc()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			for _, b := range acquired {
+				b.inFlight--
+				metrics.RateLimitInFlight.WithLabelValues(string(b.scope)).Dec()
+			}
+		})
+	}, nil
+}
+
+func (l *Limiter) limitFor(k bucketKey) Limit {
+	switch k.scope {
+	case ScopeIdentity:
+		if limit, ok := l.config.Overrides.Identities[k.key]; ok {
+			return limit
+		}
+		return l.config.Identity
+	case ScopeTenant:
+		if limit, ok := l.config.Overrides.Tenants[k.key]; ok {
+			return limit
+		}
+		return l.config.Tenant
+	case ScopeInstance:
+		if limit, ok := l.config.Overrides.Instances[k.key]; ok {
+			return limit
+		}
+		return l.config.Instance
+	default:
+		return Limit{}
+	}
+}
+
+func (l *Limiter) bucket(k bucketKey, limit Limit) *bucket {
+	b, ok := l.buckets[k]
+	if !ok {
+		b = &bucket{
+			scope: k.scope,
+			limit: limit,
+			rate:  newRateLimiter(limit),
+		}
+		l.buckets[k] = b
+		l.updateTrackedKeys()
+	}
+	return b
+}
+
+// sweep removes the state of idle limiters
+func (l *Limiter) sweep(now time.Time) {
+	for k, b := range l.buckets {
+		if b.inFlight == 0 && now.Sub(b.lastUsed) > idleTimeout {
+			delete(l.buckets, k)
+		}
+	}
+	l.lastSweep = now
+	l.updateTrackedKeys()
+}
+
+func (l *Limiter) updateTrackedKeys() {
+	counts := map[ScopeType]int{ScopeIdentity: 0, ScopeTenant: 0, ScopeInstance: 0}
+	for k := range l.buckets {
+		counts[k.scope]++
+	}
+	for scope, count := range counts {
+		metrics.RateLimitTrackedKeys.WithLabelValues(string(scope)).Set(float64(count))
+	}
+}
+
+func newRateLimiter(limit Limit) *rate.Limiter {
+	if limit.RPS <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(limit.RPS), burst(limit))
+}
+
+// updateRateLimiter changes the rate and burst of an existing limiter, which keeps the available tokens.
+func updateRateLimiter(r *rate.Limiter, limit Limit) *rate.Limiter {
+	if r == nil || limit.RPS <= 0 {
+		return newRateLimiter(limit)
+	}
+	r.SetLimit(rate.Limit(limit.RPS))
+	r.SetBurst(burst(limit))
+	return r
+}
+
+func burst(limit Limit) int {
+	if limit.Burst <= 0 {
+		return 1
+	}
+	return limit.Burst
+}
+
+func roundUp(d time.Duration) time.Duration {
+	return time.Duration(math.Ceil(d.Seconds())) * time.Second
+}
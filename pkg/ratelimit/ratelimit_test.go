@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func acquire(t *testing.T, l *Limiter, key Key) *LimitError {
+	t.Helper()
+	release, err := l.Acquire(key)
+	if err != nil {
+		var limitErr *LimitError
+		require.True(t, errors.As(err, &limitErr))
+		return limitErr
+	}
+	release()
+	return nil
+}
+
+func TestAcquire(t *testing.T) {
+	l := New(Config{
+		Identity: Limit{RPS: 0.001, Burst: 2},
+		Tenant:   Limit{MaxInFlight: 1},
+		Overrides: Overrides{
+			Identities: map[string]Limit{"admin": {}},
+		},
+	})
+
+	require.Nil(t, acquire(t, l, Key{Identity: "alice"}))
+	require.Nil(t, acquire(t, l, Key{Identity: "alice"}))
+	limitErr := acquire(t, l, Key{Identity: "alice"})
+	require.NotNil(t, limitErr)
+	require.Equal(t, ScopeIdentity, limitErr.Scope)
+	require.Equal(t, ReasonRateLimit, limitErr.Reason)
+	require.Nil(t, acquire(t, l, Key{Identity: "bob"}))
+
+	// Overrides replace the defaults
+	for range 5 {
+		require.Nil(t, acquire(t, l, Key{Identity: "admin"}))
+	}
+
+	release, err := l.Acquire(Key{Identity: "admin", Tenant: "prod"})
+	require.NoError(t, err)
+	limitErr = acquire(t, l, Key{Identity: "admin", Tenant: "prod"})
+	require.NotNil(t, limitErr)
+	require.Equal(t, ScopeTenant, limitErr.Scope)
+	require.Equal(t, ReasonMaxInFlight, limitErr.Reason)
+	release()
+	require.Nil(t, acquire(t, l, Key{Identity: "admin", Tenant: "prod"}))
+}
+
+func TestAcquireRollback(t *testing.T) {
+	l := New(Config{Identity: Limit{MaxInFlight: 1}, Instance: Limit{MaxInFlight: 1}})
+
+	release, err := l.Acquire(Key{Identity: "alice", Instance: "tracing/prod"})
+	require.NoError(t, err)
+	require.NotNil(t, acquire(t, l, Key{Identity: "bob", Instance: "tracing/prod"}))
+	release()
+
+	// The rejected call does not hold the limit of bob
+	require.Nil(t, acquire(t, l, Key{Identity: "bob"}))
+}
+
+func TestSetConfig(t *testing.T) {
+	config := Config{Identity: Limit{RPS: 0.001, Burst: 1}}
+	l := New(config)
+	require.Nil(t, acquire(t, l, Key{Identity: "alice"}))
+	require.NotNil(t, acquire(t, l, Key{Identity: "alice"}))
+
+	// Unchanged limits keep their state
+	l.SetConfig(config)
+	require.NotNil(t, acquire(t, l, Key{Identity: "alice"}))
+	config.Tenant = Limit{MaxInFlight: 10}
+	l.SetConfig(config)
+	require.NotNil(t, acquire(t, l, Key{Identity: "alice"}))
+
+	// Changed limits keep the available tokens
+	config.Identity.Burst = 5
+	l.SetConfig(config)
+	require.NotNil(t, acquire(t, l, Key{Identity: "alice"}))
+
+	// Removed limits remove the state
+	config.Identity = Limit{}
+	l.SetConfig(config)
+	require.Nil(t, acquire(t, l, Key{Identity: "alice"}))
+	config.Identity = Limit{RPS: 0.001, Burst: 1}
+	l.SetConfig(config)
+	require.Nil(t, acquire(t, l, Key{Identity: "alice"}))
+	require.NotNil(t, acquire(t, l, Key{Identity: "alice"}))
+}
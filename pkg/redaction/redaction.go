@@ -0,0 +1,348 @@
+package redaction
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const redacted = "[REDACTED]"
+
+type ActionType string
+
+const (
+	// Replace the value with [REDACTED].
+	ActionMask ActionType = "mask"
+	// Replace the value with a hash, equal values keep equal hashes.
+	ActionHash ActionType = "hash"
+)
+
+// Config redacts span attributes in the results of tool calls, before they are returned to the caller.
+type Config struct {
+	// Rules applied to the results of all tenants and of single-tenant instances.
+	Rules `json:",inline"`
+	// Rules of specific tenants, applied in addition to the default rules.
+	Tenants map[string]Rules `json:"tenants,omitempty"`
+	// Secret salt of the hashes, which prevents guessing hashed values by hashing candidates. Required if values are hashed.
+	HashSalt string `json:"hashSalt,omitempty"`
+	// Tools which return the values of the attribute named by an argument, and the name of the argument.
+	// All values are redacted if the attribute is masked or hashed. Defaults to the get-attribute-values tool of the Tempo MCP server.
+	ValueTools map[string]string `json:"valueTools,omitempty"`
+}
+
+type Rules struct {
+	// Replace the values of attributes with these keys (glob patterns, e.g. http.request.header.*) with [REDACTED].
+	// Keys match with and without the scope, e.g. http.url matches span.http.url.
+	DenyKeys []string `json:"denyKeys,omitempty"`
+	// Replace the values of attributes with these keys (glob patterns) with a hash.
+	HashKeys []string `json:"hashKeys,omitempty"`
+	// Replace matches of regular expressions in all values.
+	Patterns []Pattern `json:"patterns,omitempty"`
+}
+
+type Pattern struct {
+	Regex string `json:"regex"`
+	// mask or hash. Defaults to mask.
+	Action ActionType `json:"action,omitempty"`
+}
+
+// DefaultValueTools are the tools of the Tempo MCP server which return attribute values.
+var DefaultValueTools = map[string]string{
+	"get-attribute-values": "name",
+}
+
+const minHashSaltLength = 16
+
+var scopes = []string{"span.", "resource.", "event.", "link.", "instrumentation."}
+
+func (c Config) Validate() error {
+	var errs []error
+	// prefix is empty for the default rules, and tenants[<tenant>]. for the rules of a tenant
+	hashing := false
+	validate := func(prefix string, rules Rules) {
+		if len(rules.HashKeys) > 0 {
+			hashing = true
+		}
+		for _, keys := range []struct {
+			field    string
+			patterns []string
+		}{{"denyKeys", rules.DenyKeys}, {"hashKeys", rules.HashKeys}} {
+			for _, pattern := range keys.patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					errs = append(errs, fmt.Errorf("%s%s: invalid key pattern %q: %w", prefix, keys.field, pattern, err))
+				}
+			}
+		}
+		for i, pattern := range rules.Patterns {
+			if _, err := regexp.Compile(pattern.Regex); err != nil {
+				errs = append(errs, fmt.Errorf("%spatterns[%d]: invalid regular expression %q: %w", prefix, i, pattern.Regex, err))
+			}
+			switch pattern.Action {
+			case ActionHash:
+				hashing = true
+			case "", ActionMask:
+			default:
+				errs = append(errs, fmt.Errorf("%spatterns[%d]: invalid action %q, expected %s or %s", prefix, i, pattern.Action, ActionMask, ActionHash))
+			}
+		}
+	}
+	validate("", c.Rules)
+	for _, tenant := range slices.Sorted(maps.Keys(c.Tenants)) {
+		validate(fmt.Sprintf("tenants[%s].", tenant), c.Tenants[tenant])
+	}
+	// Without a secret salt, hashed values such as user IDs or email addresses can be recovered by hashing candidates
+	if hashing && len(c.HashSalt) < minHashSaltLength {
+		errs = append(errs, fmt.Errorf("hashSalt: must be a secret of at least %d characters if values are hashed", minHashSaltLength))
+	}
+	return errors.Join(errs...)
+}
+
+// Redactor redacts the results of tool calls.
+type Redactor struct {
+	config atomic.Pointer[compiledConfig]
+}
+
+type compiledConfig struct {
+	config   Config
+	patterns map[string]*regexp.Regexp
+}
+
+// New returns a redactor. The config must be valid.
+func New(config Config) *Redactor {
+	r := &Redactor{}
+	r.SetConfig(config)
+	return r
+}
+
+// SetConfig replaces the redaction rules. The config must be valid.
+func (r *Redactor) SetConfig(config Config) {
+	compiled := &compiledConfig{config: config, patterns: map[string]*regexp.Regexp{}}
+	for _, rules := range slices.Concat([]Rules{config.Rules}, slices.Collect(maps.Values(config.Tenants))) {
+		for _, pattern := range rules.Patterns {
+			// Invalid patterns are rejected by Validate
+			if re, err := regexp.Compile(pattern.Regex); err == nil {
+				compiled.patterns[pattern.Regex] = re
+			}
+		}
+	}
+	r.config.Store(compiled)
+}
+
+// rules are the redaction rules of a tool call.
+type rules struct {
+	denyKeys []string
+	hashKeys []string
+	patterns []compiledPattern
+	salt     string
+}
+
+type compiledPattern struct {
+	re     *regexp.Regexp
+	action ActionType
+}
+
+func (c *compiledConfig) rulesFor(tenant string) *rules {
+	r := &rules{salt: c.config.HashSalt}
+	ruleSets := []Rules{c.config.Rules}
+	if tenantRules, ok := c.config.Tenants[tenant]; ok && tenant != "" {
+		ruleSets = append(ruleSets, tenantRules)
+	}
+	for _, set := range ruleSets {
+		r.denyKeys = append(r.denyKeys, set.DenyKeys...)
+		r.hashKeys = append(r.hashKeys, set.HashKeys...)
+		for _, pattern := range set.Patterns {
+			if re, ok := c.patterns[pattern.Regex]; ok {
+				r.patterns = append(r.patterns, compiledPattern{re: re, action: pattern.Action})
+			}
+		}
+	}
+	return r
+}
+
+func (r *rules) empty() bool {
+	return len(r.denyKeys) == 0 && len(r.hashKeys) == 0 && len(r.patterns) == 0
+}
+
+// Redact redacts the text and structured content of a tool result of the tenant in place.
+// Text content which contains JSON is redacted like structured content, other text content is only redacted with the patterns.
+func (r *Redactor) Redact(result *mcp.CallToolResult, tool string, args map[string]any, tenant string) {
+	if result == nil {
+		return
+	}
+	config := r.config.Load()
+	rules := config.rulesFor(tenant)
+	if rules.empty() {
+		return
+	}
+
+	// Redact all values of tools which return the values of a redacted attribute
+	valueTools := config.config.ValueTools
+	if valueTools == nil {
+		valueTools = DefaultValueTools
+	}
+	action := ActionType("")
+	if arg, ok := valueTools[tool]; ok {
+		if key, ok := args[arg].(string); ok {
+			action = rules.keyAction(key)
+		}
+	}
+
+	for i, content := range result.Content {
+		text, ok := content.(mcp.TextContent)
+		if !ok {
+			continue
+		}
+		text.Text = rules.redactText(text.Text, action)
+		result.Content[i] = text
+	}
+	if result.StructuredContent != nil {
+		result.StructuredContent = rules.redactStructured(result.StructuredContent, action)
+	}
+}
+
+// RedactText redacts a text of the tenant, for example a trace in the OTLP JSON format fetched from the Tempo API.
+// JSON is redacted like structured content, other text is only redacted with the patterns.
+func (r *Redactor) RedactText(text string, tenant string) string {
+	rules := r.config.Load().rulesFor(tenant)
+	if rules.empty() {
+		return text
+	}
+	return rules.redactText(text, "")
+}
+
+func (r *rules) redactText(text string, action ActionType) string {
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil || value == nil {
+		return r.redactString(text, action)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(r.redactValue(value, action)); err != nil {
+		// Never return unredacted text
+		return redacted
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// redactStructured redacts structured content, which is converted to decoded JSON first.
+func (r *rules) redactStructured(content any, action ActionType) any {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return redacted
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return redacted
+	}
+	return r.redactValue(value, action)
+}
+
+// redactValue redacts a decoded JSON value. All strings are redacted with the action, if set.
+// Attributes are OTLP key-value objects ({"key": "...", "value": {...}}) and fields of objects.
+func (r *rules) redactValue(value any, action ActionType) any {
+	switch v := value.(type) {
+	case map[string]any:
+		if key, ok := v["key"].(string); ok && len(v) <= 2 {
+			if attrValue, ok := v["value"]; ok {
+				v["value"] = r.redactValue(attrValue, stronger(action, r.keyAction(key)))
+				return v
+			}
+		}
+		for k, field := range v {
+			v[k] = r.redactValue(field, stronger(action, r.keyAction(k)))
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = r.redactValue(item, action)
+		}
+		return v
+	case string:
+		return r.redactString(v, action)
+	case nil, bool:
+		return v
+	default:
+		// Numbers of masked or hashed attributes
+		if action != "" {
+			return r.redactString(fmt.Sprint(v), action)
+		}
+		return v
+	}
+}
+
+func (r *rules) redactString(s string, action ActionType) string {
+	switch action {
+	case ActionMask:
+		return redacted
+	case ActionHash:
+		return r.hash(s)
+	}
+
+	for _, pattern := range r.patterns {
+		if pattern.action == ActionHash {
+			s = pattern.re.ReplaceAllStringFunc(s, r.hash)
+		} else {
+			s = pattern.re.ReplaceAllLiteralString(s, redacted)
+		}
+	}
+	return s
+}
+
+func (r *rules) hash(s string) string {
+	sum := sha256.Sum256([]byte(r.salt + s))
+	return "sha256:" + hex.EncodeToString(sum[:])[:16]
+}
+
+// keyAction returns the action of an attribute key. Masking takes precedence over hashing.
+func (r *rules) keyAction(key string) ActionType {
+	keys := []string{key}
+	for _, scope := range scopes {
+		if name, ok := strings.CutPrefix(key, scope); ok {
+			keys = append(keys, name)
+		}
+	}
+
+	switch {
+	case matchesAny(r.denyKeys, keys):
+		return ActionMask
+	case matchesAny(r.hashKeys, keys):
+		return ActionHash
+	default:
+		return ""
+	}
+}
+
+func matchesAny(patterns []string, keys []string) bool {
+	for _, pattern := range patterns {
+		for _, key := range keys {
+			if ok, _ := path.Match(pattern, key); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stronger returns the stronger of two actions.
+func stronger(a ActionType, b ActionType) ActionType {
+	if a == ActionMask || b == ActionMask {
+		return ActionMask
+	}
+	if a == ActionHash || b == ActionHash {
+		return ActionHash
+	}
+	return ""
+}
@@ -0,0 +1,201 @@
+package redaction
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+const testSalt = "0123456789abcdef"
+
+func testHash(salt string, value string) string {
+	sum := sha256.Sum256([]byte(salt + value))
+	return "sha256:" + hex.EncodeToString(sum[:])[:16]
+}
+
+func TestRedact(t *testing.T) {
+	config := Config{
+		Rules: Rules{
+			DenyKeys: []string{"http.request.header.*", "db.statement", "password"},
+			HashKeys: []string{"user.id", "email", "password"},
+			Patterns: []Pattern{
+				{Regex: `\d{4}-\d{4}-\d{4}-\d{4}`},
+				{Regex: `[a-z]+@example\.com`, Action: ActionHash},
+			},
+		},
+		Tenants: map[string]Rules{
+			"team-a": {DenyKeys: []string{"team.secret"}},
+		},
+		HashSalt: testSalt,
+	}
+
+	tests := []struct {
+		name   string
+		tool   string
+		args   map[string]any
+		tenant string
+		text   string
+		want   string
+	}{
+		{
+			name: "OTLP attribute with a glob pattern",
+			text: `{"attributes":[{"key":"http.request.header.authorization","value":{"stringValue":"Bearer secret"}},{"key":"http.method","value":{"stringValue":"GET"}}]}`,
+			want: `{"attributes":[{"key":"http.request.header.authorization","value":{"stringValue":"[REDACTED]"}},{"key":"http.method","value":{"stringValue":"GET"}}]}`,
+		},
+		{
+			name: "object fields with and without scope",
+			text: `{"span.db.statement":"SELECT 1","db.statement":"SELECT 2","resource.db.statement":"SELECT 3","db.system":"postgres"}`,
+			want: `{"span.db.statement":"[REDACTED]","db.statement":"[REDACTED]","resource.db.statement":"[REDACTED]","db.system":"postgres"}`,
+		},
+		{
+			name: "hashed values and numbers",
+			text: `{"attributes":[{"key":"user.id","value":{"intValue":"42"}}],"span.user.id":42}`,
+			want: `{"attributes":[{"key":"user.id","value":{"intValue":"` + testHash(testSalt, "42") + `"}}],"span.user.id":"` + testHash(testSalt, "42") + `"}`,
+		},
+		{
+			name: "masking takes precedence over hashing",
+			text: `{"password":"hunter2"}`,
+			want: `{"password":"[REDACTED]"}`,
+		},
+		{
+			name: "nested arrays and objects",
+			text: `{"batches":[{"scopeSpans":[{"spans":[{"attributes":[{"key":"email","value":{"arrayValue":{"values":[{"stringValue":"a"},{"stringValue":"b"}]}}},{"key":"request","value":{"kvlistValue":{"values":[{"key":"db.statement","value":{"stringValue":"SELECT 1"}}]}}}]}]}]}]}`,
+			want: `{"batches":[{"scopeSpans":[{"spans":[{"attributes":[{"key":"email","value":{"arrayValue":{"values":[{"stringValue":"` + testHash(testSalt, "a") + `"},{"stringValue":"` + testHash(testSalt, "b") + `"}]}}},{"key":"request","value":{"kvlistValue":{"values":[{"key":"db.statement","value":{"stringValue":"[REDACTED]"}}]}}}]}]}]}]}`,
+		},
+		{
+			name: "patterns in JSON values",
+			text: `{"message":"card 1234-5678-9012-3456 of alice@example.com declined","count":3}`,
+			want: `{"message":"card [REDACTED] of ` + testHash(testSalt, "alice@example.com") + ` declined","count":3}`,
+		},
+		{
+			name: "patterns in text",
+			text: "card 1234-5678-9012-3456 declined",
+			want: "card [REDACTED] declined",
+		},
+		{
+			name:   "tenant rules",
+			tenant: "team-a",
+			text:   `{"team.secret":"x","db.statement":"SELECT 1"}`,
+			want:   `{"team.secret":"[REDACTED]","db.statement":"[REDACTED]"}`,
+		},
+		{
+			name:   "rules of other tenants",
+			tenant: "team-b",
+			text:   `{"team.secret":"x"}`,
+			want:   `{"team.secret":"x"}`,
+		},
+		{
+			name: "values of a masked attribute",
+			tool: "get-attribute-values",
+			args: map[string]any{"name": "span.db.statement"},
+			text: `{"tagValues":[{"type":"string","value":"SELECT 1"}]}`,
+			want: `{"tagValues":[{"type":"[REDACTED]","value":"[REDACTED]"}]}`,
+		},
+		{
+			name: "values of a hashed attribute",
+			tool: "get-attribute-values",
+			args: map[string]any{"name": "user.id"},
+			text: `["a","b"]`,
+			want: `["` + testHash(testSalt, "a") + `","` + testHash(testSalt, "b") + `"]`,
+		},
+		{
+			name: "values of other attributes",
+			tool: "get-attribute-values",
+			args: map[string]any{"name": "http.method"},
+			text: `["GET","POST"]`,
+			want: `["GET","POST"]`,
+		},
+	}
+
+	redactor := New(config)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tool := tc.tool
+			if tool == "" {
+				tool = "traceql-search"
+			}
+			result := mcp.NewToolResultText(tc.text)
+			redactor.Redact(result, tool, tc.args, tc.tenant)
+			text := result.Content[0].(mcp.TextContent).Text
+			if tc.want[0] == '{' || tc.want[0] == '[' {
+				require.JSONEq(t, tc.want, text)
+			} else {
+				require.Equal(t, tc.want, text)
+			}
+		})
+	}
+}
+
+func TestRedactStructuredContent(t *testing.T) {
+	redactor := New(Config{Rules: Rules{DenyKeys: []string{"db.statement"}}})
+	result := mcp.NewToolResultStructured(map[string]any{"spans": []map[string]string{{"db.statement": "SELECT 1"}}}, `{"spans":[{"db.statement":"SELECT 1"}]}`)
+
+	redactor.Redact(result, "traceql-search", nil, "")
+	require.Equal(t, map[string]any{"spans": []any{map[string]any{"db.statement": redacted}}}, result.StructuredContent)
+	require.JSONEq(t, `{"spans":[{"db.statement":"[REDACTED]"}]}`, result.Content[0].(mcp.TextContent).Text)
+}
+
+func TestHashSalt(t *testing.T) {
+	text := `{"user.id":"alice"}`
+	redact := func(salt string) string {
+		result := mcp.NewToolResultText(text)
+		New(Config{Rules: Rules{HashKeys: []string{"user.id"}}, HashSalt: salt}).Redact(result, "traceql-search", nil, "")
+		return result.Content[0].(mcp.TextContent).Text
+	}
+
+	// Equal values keep equal hashes, the hash depends on the salt
+	require.Equal(t, redact(testSalt), redact(testSalt))
+	require.JSONEq(t, `{"user.id":"`+testHash(testSalt, "alice")+`"}`, redact(testSalt))
+	require.NotEqual(t, redact(testSalt), redact("fedcba9876543210"))
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		err    string
+	}{
+		{
+			name:   "mask without salt",
+			config: Config{Rules: Rules{DenyKeys: []string{"http.*"}, Patterns: []Pattern{{Regex: "secret"}}}},
+		},
+		{
+			name:   "hash keys without salt",
+			config: Config{Rules: Rules{HashKeys: []string{"user.id"}}},
+			err:    "hashSalt: must be a secret of at least 16 characters if values are hashed",
+		},
+		{
+			name:   "tenant hash pattern with a short salt",
+			config: Config{Tenants: map[string]Rules{"a": {Patterns: []Pattern{{Regex: "x", Action: ActionHash}}}}, HashSalt: "short"},
+			err:    "hashSalt: must be a secret of at least 16 characters if values are hashed",
+		},
+		{
+			name:   "hash keys with salt",
+			config: Config{Rules: Rules{HashKeys: []string{"user.id"}}, HashSalt: testSalt},
+		},
+		{
+			name:   "invalid key pattern",
+			config: Config{Rules: Rules{DenyKeys: []string{"[a"}}},
+			err:    `denyKeys: invalid key pattern "[a": syntax error in pattern`,
+		},
+		{
+			name:   "invalid regular expression and action",
+			config: Config{Tenants: map[string]Rules{"a": {Patterns: []Pattern{{Regex: "(", Action: "drop"}}}}},
+			err:    "tenants[a].patterns[0]: invalid regular expression \"(\": error parsing regexp: missing closing ): `(`\ntenants[a].patterns[0]: invalid action \"drop\", expected mask or hash",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.Validate()
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tc.err)
+		})
+	}
+}
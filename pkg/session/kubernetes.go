@@ -0,0 +1,164 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// LabelSession marks the Secrets which hold sessions.
+	LabelSession = "tempo-mcp-gateway/session"
+	// AnnotationExpiresAt holds the expiry of the session in RFC 3339 format.
+	AnnotationExpiresAt = "tempo-mcp-gateway/expires-at"
+
+	sessionSecretKey    = "session.json"
+	sessionSecretPrefix = "tempo-mcp-gateway-session-"
+)
+
+// KubernetesStore keeps every session in a Secret, therefore all replicas of the gateway share the sessions.
+// The gateway requires permissions to get, list, create, update and delete Secrets in the namespace.
+type KubernetesStore struct {
+	logger    *zap.Logger
+	k8sClient client.Client
+	namespace string
+	ttl       time.Duration
+}
+
+func NewKubernetesStore(logger *zap.Logger, k8sClient client.Client, namespace string, ttl time.Duration) *KubernetesStore {
+	return &KubernetesStore{
+		logger:    logger,
+		k8sClient: k8sClient,
+		namespace: namespace,
+		ttl:       ttl,
+	}
+}
+
+func (k *KubernetesStore) Get(ctx context.Context, id string) (*Session, error) {
+	var secret corev1.Secret
+	err := k.k8sClient.Get(ctx, types.NamespacedName{Namespace: k.namespace, Name: secretName(id)}, &secret)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	if expired(&secret, time.Now()) {
+		return nil, nil
+	}
+
+	var session Session
+	err = json.Unmarshal(secret.Data[sessionSecretKey], &session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse session %s: %w", id, err)
+	}
+	// Secret names are lowercase, therefore different session IDs can map to the same Secret
+	if session.ID != id {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+func (k *KubernetesStore) Put(ctx context.Context, session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: k.namespace,
+			Name:      secretName(session.ID),
+		},
+	}
+	_, err = controllerutil.CreateOrUpdate(ctx, k.k8sClient, secret, func() error {
+		if secret.Labels == nil {
+			secret.Labels = map[string]string{}
+		}
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		secret.Labels[LabelSession] = "true"
+		secret.Annotations[AnnotationExpiresAt] = time.Now().Add(k.ttl).UTC().Format(time.RFC3339)
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = map[string][]byte{sessionSecretKey: data}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store session: %w", err)
+	}
+	return nil
+}
+
+func (k *KubernetesStore) Delete(ctx context.Context, id string) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: k.namespace,
+			Name:      secretName(id),
+		},
+	}
+	err := k.k8sClient.Delete(ctx, secret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// Run removes expired sessions periodically. It can run on every replica.
+func (k *KubernetesStore) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := k.removeExpired(ctx)
+			if err != nil {
+				k.logger.Error("error removing expired sessions", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (k *KubernetesStore) removeExpired(ctx context.Context) error {
+	var list corev1.SecretList
+	err := k.k8sClient.List(ctx, &list, client.InNamespace(k.namespace), client.MatchingLabels{LabelSession: "true"})
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	now := time.Now()
+	for i := range list.Items {
+		secret := &list.Items[i]
+		if !expired(secret, now) {
+			continue
+		}
+		err := k.k8sClient.Delete(ctx, secret, client.Preconditions{ResourceVersion: &secret.ResourceVersion})
+		if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+			return fmt.Errorf("failed to delete session %s: %w", secret.Name, err)
+		}
+	}
+	return nil
+}
+
+func expired(secret *corev1.Secret, now time.Time) bool {
+	expiresAt, err := time.Parse(time.RFC3339, secret.Annotations[AnnotationExpiresAt])
+	return err != nil || now.After(expiresAt)
+}
+
+// secretName returns a valid Secret name for a session ID.
+func secretName(id string) string {
+	return sessionSecretPrefix + strings.ToLower(strings.TrimPrefix(id, "mcp-session-"))
+}
@@ -0,0 +1,85 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the sessions in memory. Sessions are lost on restart and are not shared between replicas.
+type MemoryStore struct {
+	ttl      time.Duration
+	mu       sync.Mutex
+	sessions map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	session   Session
+	expiresAt time.Time
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		ttl:      ttl,
+		sessions: map[string]memoryEntry{},
+	}
+}
+
+func (m *MemoryStore) Get(ctx context.Context, id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.sessions[id]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, nil
+	}
+	// Return a copy, therefore callers can modify the session without holding the lock
+	session := entry.session
+	return &session, nil
+}
+
+func (m *MemoryStore) Put(ctx context.Context, session *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[session.ID] = memoryEntry{
+		session:   *session,
+		expiresAt: time.Now().Add(m.ttl),
+	}
+	return nil
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+// Run removes expired sessions periodically.
+func (m *MemoryStore) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.removeExpired()
+		}
+	}
+}
+
+func (m *MemoryStore) removeExpired() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, entry := range m.sessions {
+		if now.After(entry.expiresAt) {
+			delete(m.sessions, id)
+		}
+	}
+}
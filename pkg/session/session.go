@@ -0,0 +1,41 @@
+package session
+
+import (
+	"context"
+	"time"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/auth"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tempodiscovery"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tlsconfig"
+)
+
+// Session is the state of a stateful MCP session. It is shared by all replicas of the gateway, if the store is shared.
+// Open connections, for example the downstream MCP sessions, are not part of the session state, because they are local to a replica.
+type Session struct {
+	ID string `json:"id"`
+	// The caller which initialized the session. Requests of other callers are rejected.
+	Identity  auth.Identity `json:"identity"`
+	Client    string        `json:"client,omitempty"`
+	CreatedAt time.Time     `json:"createdAt"`
+	// The last time the session was used. Sessions expire after the TTL of the store without requests.
+	LastSeen time.Time `json:"lastSeen"`
+	// The Tempo instances accessible to the caller, cached for the instance cache TTL.
+	Instances          []Instance `json:"instances,omitempty"`
+	InstancesUpdatedAt time.Time  `json:"instancesUpdatedAt,omitzero"`
+}
+
+// Instance is a cached Tempo instance.
+// The CA bundle is stored separately, because it is not part of the JSON representation of a Tempo instance.
+type Instance struct {
+	tempodiscovery.TempoInstance
+	CABundle *tlsconfig.ConfigMapRef `json:"caBundle,omitempty"`
+}
+
+// Store persists sessions. Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns the session, or nil if the session does not exist or expired.
+	Get(ctx context.Context, id string) (*Session, error)
+	// Put creates or updates the session and extends its expiry.
+	Put(ctx context.Context, session *Session) error
+	Delete(ctx context.Context, id string) error
+}
@@ -2,13 +2,24 @@ package tempodiscovery
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
+	"time"
 
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/logging"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/metrics"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tlsconfig"
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/tracing"
 	tempov1alpha1 "github.com/grafana/tempo-operator/api/tempo/v1alpha1"
+	configv1 "github.com/openshift/api/config/v1"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -20,17 +31,45 @@ var (
 )
 
 func init() {
+	utilruntime.Must(corev1.AddToScheme(Scheme))
+	utilruntime.Must(authenticationv1.AddToScheme(Scheme))
+	utilruntime.Must(configv1.AddToScheme(Scheme))
 	utilruntime.Must(tempov1alpha1.AddToScheme(Scheme))
 }
 
+// Annotations on TempoStack and TempoMonolithic instances to trust a CA bundle from a ConfigMap in the namespace of the instance.
+const (
+	AnnotationCAConfigMap    = "tempo-mcp-gateway/ca-configmap"
+	AnnotationCAConfigMapKey = "tempo-mcp-gateway/ca-configmap-key"
+)
+
 type TempoDiscovery struct {
 	logger    *zap.Logger
 	k8sClient client.Client
-	tlsConfig *tls.Config
+	tlsClient *tlsconfig.Client
+	config    Config
+}
+
+// Config restricts and adjusts the discovered Tempo instances.
+type Config struct {
+	// Only discover Tempo instances in these namespaces. All namespaces are searched if empty.
+	Namespaces []string
+	// Overrides of individual instances, by <namespace>/<name>.
+	Instances map[string]InstanceOverride
+}
+
+type InstanceOverride struct {
+	// Hide the instance from all callers.
+	Disabled bool
+	// Verify the endpoints of the instance with this CA bundle. Takes precedence over the annotations of the instance.
+	CABundle *tlsconfig.ConfigMapRef
 }
 
 type Authentication struct {
 	BearerToken string
+	// Restrict access to these tenants. Single-tenant instances are not accessible if this list is set.
+	// A nil list does not restrict access.
+	AllowedTenants []string
 }
 
 type TempoInstance struct {
@@ -43,6 +82,8 @@ type TempoInstance struct {
 	// A list of tenant names for multi-tenant instances, or an empty list for single-tenant instances.
 	Tenants []string `json:"tenants,omitempty"`
 	Status  string   `json:"status"`
+	// The CA bundle to verify the Tempo endpoints, if it differs from the globally configured CA bundle.
+	CABundle *tlsconfig.ConfigMapRef `json:"-"`
 }
 
 type KindType string
@@ -52,16 +93,24 @@ const (
 	KindTempoMonolithic KindType = "TempoMonolithic"
 )
 
-func New(logger *zap.Logger, k8sClient client.Client, tlsConfig *tls.Config) *TempoDiscovery {
+func New(logger *zap.Logger, k8sClient client.Client, tlsClient *tlsconfig.Client, config Config) *TempoDiscovery {
 	return &TempoDiscovery{
 		logger:    logger,
 		k8sClient: k8sClient,
-		tlsConfig: tlsConfig,
+		tlsClient: tlsClient,
+		config:    config,
 	}
 }
 
 // TODO: caching
-func (d *TempoDiscovery) ListInstances(ctx context.Context, auth Authentication, verbs []string) ([]TempoInstance, error) {
+func (d *TempoDiscovery) ListInstances(ctx context.Context, auth Authentication, verbs []string) (_ []TempoInstance, err error) {
+	ctx, span := tracing.Tracer.Start(ctx, "discovery")
+	start := time.Now()
+	defer func() {
+		metrics.DiscoveryDuration.Observe(time.Since(start).Seconds())
+		tracing.EndSpan(span, err)
+	}()
+
 	tempos := []TempoInstance{}
 
 	tempoStacks, err := d.listTempoStacks(ctx)
@@ -75,6 +124,11 @@ func (d *TempoDiscovery) ListInstances(ctx context.Context, auth Authentication,
 		return nil, err
 	}
 	tempos = append(tempos, tempoMonolithics...)
+	tempos = d.config.ApplyOverrides(tempos)
+
+	if auth.AllowedTenants != nil {
+		tempos = filterAllowedTenants(tempos, auth.AllowedTenants)
+	}
 
 	filtered, err := d.filterAccessibleInstancesGateway(ctx, auth, tempos, verbs)
 	if err != nil {
@@ -84,15 +138,66 @@ func (d *TempoDiscovery) ListInstances(ctx context.Context, auth Authentication,
 	return filtered, nil
 }
 
-func (d *TempoDiscovery) listTempoStacks(ctx context.Context) ([]TempoInstance, error) {
-	var tempos tempov1alpha1.TempoStackList
-	err := d.k8sClient.List(ctx, &tempos)
+// CheckCRDs verifies that the TempoStack and TempoMonolithic resources can be listed with the credentials of the gateway.
+func CheckCRDs(ctx context.Context, k8sClient client.Client) error {
+	err := k8sClient.List(ctx, &tempov1alpha1.TempoStackList{}, client.Limit(1))
+	if err != nil {
+		return fmt.Errorf("failed to list TempoStacks: %w", err)
+	}
+
+	err = k8sClient.List(ctx, &tempov1alpha1.TempoMonolithicList{}, client.Limit(1))
 	if err != nil {
-		return nil, fmt.Errorf("failed to list TempoStacks: %w", err)
+		return fmt.Errorf("failed to list TempoMonolithics: %w", err)
 	}
+	return nil
+}
 
-	instances := make([]TempoInstance, len(tempos.Items))
-	for i, tempo := range tempos.Items {
+// namespaceOptions returns the list options for each namespace in the discovery scope.
+func (d *TempoDiscovery) namespaceOptions() [][]client.ListOption {
+	if len(d.config.Namespaces) == 0 {
+		return [][]client.ListOption{nil}
+	}
+
+	opts := make([][]client.ListOption, len(d.config.Namespaces))
+	for i, namespace := range d.config.Namespaces {
+		opts[i] = []client.ListOption{client.InNamespace(namespace)}
+	}
+	return opts
+}
+
+// ApplyOverrides removes disabled instances and applies the configured CA bundles.
+func (c Config) ApplyOverrides(instances []TempoInstance) []TempoInstance {
+	if len(c.Instances) == 0 {
+		return instances
+	}
+
+	filtered := []TempoInstance{}
+	for _, instance := range instances {
+		override, ok := c.Instances[instance.String()]
+		if ok && override.Disabled {
+			continue
+		}
+		if ok && override.CABundle != nil {
+			instance.CABundle = override.CABundle
+		}
+		filtered = append(filtered, instance)
+	}
+	return filtered
+}
+
+func (d *TempoDiscovery) listTempoStacks(ctx context.Context) ([]TempoInstance, error) {
+	var tempos []tempov1alpha1.TempoStack
+	for _, opts := range d.namespaceOptions() {
+		var list tempov1alpha1.TempoStackList
+		err := d.k8sClient.List(ctx, &list, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list TempoStacks: %w", err)
+		}
+		tempos = append(tempos, list.Items...)
+	}
+
+	instances := make([]TempoInstance, len(tempos))
+	for i, tempo := range tempos {
 		tenants := []string{}
 		if tempo.Spec.Tenants != nil && tempo.Spec.Tenants.Mode != "" {
 			for _, tenant := range tempo.Spec.Tenants.Authentication {
@@ -116,6 +221,7 @@ func (d *TempoDiscovery) listTempoStacks(ctx context.Context) ([]TempoInstance,
 			MCPEnabled:   tempo.Spec.Template.QueryFrontend.MCPServer.Enabled,
 			Tenants:      tenants,
 			Status:       status,
+			CABundle:     caBundleFromAnnotations(tempo.ObjectMeta),
 		}
 	}
 
@@ -123,14 +229,18 @@ func (d *TempoDiscovery) listTempoStacks(ctx context.Context) ([]TempoInstance,
 }
 
 func (d *TempoDiscovery) listTempoMonolithics(ctx context.Context) ([]TempoInstance, error) {
-	var tempos tempov1alpha1.TempoMonolithicList
-	err := d.k8sClient.List(ctx, &tempos)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list TempoMonolithics: %w", err)
+	var tempos []tempov1alpha1.TempoMonolithic
+	for _, opts := range d.namespaceOptions() {
+		var list tempov1alpha1.TempoMonolithicList
+		err := d.k8sClient.List(ctx, &list, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list TempoMonolithics: %w", err)
+		}
+		tempos = append(tempos, list.Items...)
 	}
 
-	instances := make([]TempoInstance, len(tempos.Items))
-	for i, tempo := range tempos.Items {
+	instances := make([]TempoInstance, len(tempos))
+	for i, tempo := range tempos {
 		tenants := []string{}
 		if tempo.Spec.Multitenancy != nil && tempo.Spec.Multitenancy.Enabled == true && tempo.Spec.Multitenancy.Mode != "" {
 			for _, tenant := range tempo.Spec.Multitenancy.Authentication {
@@ -159,12 +269,48 @@ func (d *TempoDiscovery) listTempoMonolithics(ctx context.Context) ([]TempoInsta
 			MCPEnabled:   mcpEnabled,
 			Tenants:      tenants,
 			Status:       status,
+			CABundle:     caBundleFromAnnotations(tempo.ObjectMeta),
 		}
 	}
 
 	return instances, nil
 }
 
+func caBundleFromAnnotations(meta metav1.ObjectMeta) *tlsconfig.ConfigMapRef {
+	name, ok := meta.Annotations[AnnotationCAConfigMap]
+	if !ok || name == "" {
+		return nil
+	}
+
+	return &tlsconfig.ConfigMapRef{
+		Namespace: meta.Namespace,
+		Name:      name,
+		Key:       meta.Annotations[AnnotationCAConfigMapKey],
+	}
+}
+
+// Filter Tempo instances to only include those with allowed tenants
+func filterAllowedTenants(instances []TempoInstance, allowedTenants []string) []TempoInstance {
+	filtered := []TempoInstance{}
+	for _, tempo := range instances {
+		if !tempo.Multitenancy {
+			continue
+		}
+
+		tenants := []string{}
+		for _, tenant := range tempo.Tenants {
+			if slices.Contains(allowedTenants, tenant) {
+				tenants = append(tenants, tenant)
+			}
+		}
+		if len(tenants) > 0 {
+			tempo.Tenants = tenants
+			filtered = append(filtered, tempo)
+		}
+	}
+	return filtered
+}
+
 // func (d *TempoDiscovery) filterAccessibleInstancesSSAR(ctx context.Context, k8sClient client.Client, instances []TempoInstance, verbs []string) ([]TempoInstance, error) {
 // 	allTenants := map[string]bool{}
 
@@ -238,13 +384,18 @@ func (d *TempoDiscovery) filterAccessibleInstancesGateway(ctx context.Context, a
 			if !ok {
 				access, err := d.checkAccess(ctx, auth, instance, tenant)
 				if err != nil {
-					d.logger.Error("could not check access for tenant",
+					logging.FromContext(ctx, d.logger).Error("could not check access for tenant",
 						zap.String("namespace", instance.Namespace),
 						zap.String("name", instance.Name),
 						zap.String("teanant", tenant),
 						zap.Error(err),
 					)
 					access = false
+					metrics.AccessProbes.WithLabelValues("error").Inc()
+				} else if access {
+					metrics.AccessProbes.WithLabelValues("granted").Inc()
+				} else {
+					metrics.AccessProbes.WithLabelValues("denied").Inc()
 				}
 				globallyAccessibleTenants[tenant] = access
 			}
@@ -278,9 +429,18 @@ func (d *TempoDiscovery) filterAccessibleInstancesGateway(ctx context.Context, a
 //
 // Do not perform a SubjectAccessReview here, because the gateway can have additional access rules (for example -opa.admin-groups) configured,
 // or use OIDC for authentication.
-func (d *TempoDiscovery) checkAccess(ctx context.Context, auth Authentication, instance TempoInstance, tenant string) (bool, error) {
+func (d *TempoDiscovery) checkAccess(ctx context.Context, auth Authentication, instance TempoInstance, tenant string) (access bool, err error) {
+	ctx, span := tracing.Tracer.Start(ctx, "checkAccess", trace.WithAttributes(
+		attribute.String("tempo.instance", instance.String()),
+		attribute.String("tempo.tenant", tenant),
+	))
+	defer func() {
+		span.SetAttributes(attribute.Bool("tempo.access", access))
+		tracing.EndSpan(span, err)
+	}()
+
 	url := fmt.Sprintf("%s/ready", instance.GetEndpoint(tenant))
-	log := d.logger.WithOptions(zap.Fields(
+	log := logging.FromContext(ctx, d.logger).WithOptions(zap.Fields(
 		zap.String("namespace", instance.Namespace),
 		zap.String("name", instance.Name),
 		zap.String("teanant", tenant),
@@ -296,10 +456,15 @@ func (d *TempoDiscovery) checkAccess(ctx context.Context, auth Authentication, i
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", auth.BearerToken))
 	}
 
+	tlsConfig, err := d.tlsClient.Config(ctx, instance.CABundle)
+	if err != nil {
+		return false, err
+	}
+
 	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: d.tlsConfig,
-		},
+		Transport: otelhttp.NewTransport(&http.Transport{
+			TLSClientConfig: tlsConfig,
+		}),
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
@@ -324,6 +489,11 @@ func (d *TempoDiscovery) checkAccess(ctx context.Context, auth Authentication, i
 	return true, nil
 }
 
+// String returns the namespace and name of the instance.
+func (tempo *TempoInstance) String() string {
+	return fmt.Sprintf("%s/%s", tempo.Namespace, tempo.Name)
+}
+
 func (tempo *TempoInstance) GetEndpoint(tenant string) string {
 	//return "http://localhost:3200"
 
@@ -0,0 +1,186 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/andreasgerstmayr/tempo-mcp-gateway/pkg/metrics"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultCAConfigMapKey is the key of the CA bundle in a ConfigMap, if not specified otherwise.
+const DefaultCAConfigMapKey = "ca.crt"
+
+const caConfigMapCacheTTL = time.Minute
+
+type ClientOptions struct {
+	// Trust the CA bundles in these files.
+	CAFiles []string
+	// Trust the CAs of the system root pool.
+	SystemCAs bool
+	// Present this client certificate to downstream servers. Optional.
+	CertFile string
+	KeyFile  string
+	// Do not verify the certificates of downstream servers. Only for development.
+	InsecureSkipVerify bool
+}
+
+// ConfigMapRef references a CA bundle in a ConfigMap.
+type ConfigMapRef struct {
+	Namespace string
+	Name      string
+	Key       string
+}
+
+// Client provides the TLS configuration for connections to Tempo instances.
+type Client struct {
+	logger      *zap.Logger
+	k8sClient   client.Client
+	opts        ClientOptions
+	profile     *ProfileWatcher
+	rootCAs     *x509.CertPool
+	certWatcher *certwatcher.CertWatcher
+
+	mu    sync.Mutex
+	cache map[ConfigMapRef]cachedCertPool
+}
+
+type cachedCertPool struct {
+	pool      *x509.CertPool
+	fetchedAt time.Time
+}
+
+func NewClient(logger *zap.Logger, k8sClient client.Client, opts ClientOptions, profile *ProfileWatcher) (*Client, error) {
+	c := &Client{
+		logger:    logger,
+		k8sClient: k8sClient,
+		opts:      opts,
+		profile:   profile,
+		cache:     map[ConfigMapRef]cachedCertPool{},
+	}
+
+	rootCAs, err := c.newCertPool()
+	if err != nil {
+		return nil, err
+	}
+	for _, caFile := range opts.CAFiles {
+		caPEM, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+
+		ok := rootCAs.AppendCertsFromPEM(caPEM)
+		if !ok {
+			return nil, fmt.Errorf("no CA found in CA file %s", caFile)
+		}
+	}
+	c.rootCAs = rootCAs
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		c.certWatcher, err = certwatcher.New(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+	}
+
+	if opts.InsecureSkipVerify {
+		logger.Warn("!!! TLS certificate verification of Tempo instances is DISABLED. Traffic to Tempo can be intercepted. Never use -insecure-skip-verify in production !!!")
+	}
+
+	return c, nil
+}
+
+// Start watches the client certificate for changes until the context is cancelled.
+func (c *Client) Start(ctx context.Context) error {
+	if c.certWatcher == nil {
+		return nil
+	}
+	return c.certWatcher.Start(ctx)
+}
+
+// Config returns the TLS configuration for a connection to a Tempo instance.
+// If a CA bundle ConfigMap is given, its CAs are trusted instead of the configured CA files.
+func (c *Client) Config(ctx context.Context, ca *ConfigMapRef) (*tls.Config, error) {
+	rootCAs := c.rootCAs
+	if ca != nil {
+		var err error
+		rootCAs, err = c.configMapCertPool(ctx, *ca)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	config := c.profile.Apply(&tls.Config{
+		RootCAs:            rootCAs,
+		InsecureSkipVerify: c.opts.InsecureSkipVerify,
+	})
+	if c.certWatcher != nil {
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return c.certWatcher.GetCertificate(nil)
+		}
+	}
+
+	return config, nil
+}
+
+func (c *Client) configMapCertPool(ctx context.Context, ref ConfigMapRef) (*x509.CertPool, error) {
+	if ref.Key == "" {
+		ref.Key = DefaultCAConfigMapKey
+	}
+
+	c.mu.Lock()
+	cached, ok := c.cache[ref]
+	c.mu.Unlock()
+	hit := ok && time.Since(cached.fetchedAt) < caConfigMapCacheTTL
+	metrics.CacheLookup("ca_configmap", hit)
+	if hit {
+		return cached.pool, nil
+	}
+
+	var configMap corev1.ConfigMap
+	err := c.k8sClient.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, &configMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CA ConfigMap %s/%s: %w", ref.Namespace, ref.Name, err)
+	}
+
+	caPEM, ok := configMap.Data[ref.Key]
+	if !ok {
+		return nil, fmt.Errorf("CA ConfigMap %s/%s does not contain the key %s", ref.Namespace, ref.Name, ref.Key)
+	}
+
+	pool, err := c.newCertPool()
+	if err != nil {
+		return nil, err
+	}
+	ok = pool.AppendCertsFromPEM([]byte(caPEM))
+	if !ok {
+		return nil, fmt.Errorf("no CA found in ConfigMap %s/%s key %s", ref.Namespace, ref.Name, ref.Key)
+	}
+
+	c.mu.Lock()
+	c.cache[ref] = cachedCertPool{pool: pool, fetchedAt: time.Now()}
+	c.mu.Unlock()
+
+	return pool, nil
+}
+
+func (c *Client) newCertPool() (*x509.CertPool, error) {
+	if !c.opts.SystemCAs {
+		return x509.NewCertPool(), nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load system CA pool: %w", err)
+	}
+	return pool, nil
+}
@@ -0,0 +1,178 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+	oscrypto "github.com/openshift/library-go/pkg/crypto"
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// APIServerName is the name of the OpenShift APIServer resource which holds the cluster TLS security profile.
+const APIServerName = "cluster"
+
+// Profile holds the TLS settings of a TLS security profile.
+type Profile struct {
+	Type         configv1.TLSProfileType
+	MinVersion   uint16
+	CipherSuites []uint16
+}
+
+// ProfileWatcher tracks the TLS security profile of the cluster (APIServer.spec.tlsSecurityProfile).
+// On clusters without the OpenShift APIServer resource, the library-go defaults are used.
+type ProfileWatcher struct {
+	logger    *zap.Logger
+	k8sClient client.Client
+
+	mu      sync.RWMutex
+	profile *Profile
+	loaded  bool
+}
+
+func NewProfileWatcher(logger *zap.Logger, k8sClient client.Client) *ProfileWatcher {
+	return &ProfileWatcher{
+		logger:    logger,
+		k8sClient: k8sClient,
+	}
+}
+
+// Load reads the TLS security profile of the cluster.
+// If the profile cannot be read, the previously loaded profile stays active.
+func (w *ProfileWatcher) Load(ctx context.Context) error {
+	var apiServer configv1.APIServer
+	err := w.k8sClient.Get(ctx, client.ObjectKey{Name: APIServerName}, &apiServer)
+	if meta.IsNoMatchError(err) || apierrors.IsNotFound(err) {
+		w.setProfile(nil)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get APIServer %s: %w", APIServerName, err)
+	}
+
+	// OpenShift uses the Intermediate profile if no profile is set
+	securityProfile := configv1.TLSSecurityProfile{Type: configv1.TLSProfileIntermediateType}
+	if apiServer.Spec.TLSSecurityProfile != nil {
+		securityProfile = *apiServer.Spec.TLSSecurityProfile
+	}
+
+	profile, err := profileFromSpec(securityProfile)
+	if err != nil {
+		return err
+	}
+
+	w.setProfile(profile)
+	return nil
+}
+
+// Synced returns true if the TLS security profile was loaded at least once.
+func (w *ProfileWatcher) Synced() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.loaded
+}
+
+// Run reloads the TLS security profile periodically until the context is cancelled.
+func (w *ProfileWatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := w.Load(ctx)
+			if err != nil {
+				w.logger.Error("error reloading TLS security profile", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Apply sets the minimum TLS version and cipher suites of the current profile.
+func (w *ProfileWatcher) Apply(config *tls.Config) *tls.Config {
+	w.mu.RLock()
+	profile := w.profile
+	w.mu.RUnlock()
+
+	if profile == nil {
+		return oscrypto.SecureTLSConfig(config)
+	}
+
+	config.MinVersion = profile.MinVersion
+	config.CipherSuites = profile.CipherSuites
+	return config
+}
+
+func (w *ProfileWatcher) setProfile(profile *Profile) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.loaded && profileEqual(w.profile, profile) {
+		return
+	}
+	w.profile = profile
+	w.loaded = true
+
+	if profile == nil {
+		w.logger.Info("cluster TLS security profile not found, using default TLS settings")
+	} else {
+		w.logger.Info("applying cluster TLS security profile",
+			zap.String("type", string(profile.Type)),
+			zap.String("minVersion", oscrypto.TLSVersionToNameOrDie(profile.MinVersion)),
+			zap.Strings("ciphers", oscrypto.CipherSuitesToNamesOrDie(profile.CipherSuites)),
+		)
+	}
+}
+
+func profileFromSpec(securityProfile configv1.TLSSecurityProfile) (*Profile, error) {
+	var spec configv1.TLSProfileSpec
+	switch securityProfile.Type {
+	case configv1.TLSProfileCustomType:
+		if securityProfile.Custom == nil {
+			return nil, fmt.Errorf("missing TLS custom profile spec")
+		}
+		spec = securityProfile.Custom.TLSProfileSpec
+	case configv1.TLSProfileOldType, configv1.TLSProfileIntermediateType, configv1.TLSProfileModernType:
+		spec = *configv1.TLSProfiles[securityProfile.Type]
+	default:
+		return nil, fmt.Errorf("unknown TLS security profile type %q", securityProfile.Type)
+	}
+
+	minVersion, err := oscrypto.TLSVersion(string(spec.MinTLSVersion))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS security profile: %w", err)
+	}
+
+	// OpenShift uses OpenSSL cipher names, Go uses IANA cipher names.
+	// TLS 1.3 cipher suites are not configurable in Go and therefore skipped.
+	cipherSuites := []uint16{}
+	for _, name := range oscrypto.OpenSSLToIANACipherSuites(spec.Ciphers) {
+		cipherSuite, err := oscrypto.CipherSuite(name)
+		if err != nil {
+			continue
+		}
+		cipherSuites = append(cipherSuites, cipherSuite)
+	}
+
+	return &Profile{
+		Type:         securityProfile.Type,
+		MinVersion:   minVersion,
+		CipherSuites: cipherSuites,
+	}, nil
+}
+
+func profileEqual(a *Profile, b *Profile) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Type == b.Type && a.MinVersion == b.MinVersion && slices.Equal(a.CipherSuites, b.CipherSuites)
+}
@@ -0,0 +1,146 @@
+package tlsconfig
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+)
+
+type ServerOptions struct {
+	CertFile string
+	KeyFile  string
+	// Verify client certificates against this CA bundle. Optional.
+	ClientCAFile string
+	// Reject connections without a valid client certificate.
+	RequireClientCert bool
+}
+
+// Server provides the TLS configuration of the gateway listener.
+// The certificate, key and client CA bundle are reloaded when the files change.
+type Server struct {
+	logger      *zap.Logger
+	opts        ServerOptions
+	profile     *ProfileWatcher
+	certWatcher *certwatcher.CertWatcher
+
+	mu          sync.RWMutex
+	clientCAs   *x509.CertPool
+	clientCAPEM []byte
+}
+
+func NewServer(logger *zap.Logger, opts ServerOptions, profile *ProfileWatcher) (*Server, error) {
+	if opts.RequireClientCert && opts.ClientCAFile == "" {
+		return nil, fmt.Errorf("a client CA file is required to verify client certificates")
+	}
+
+	certWatcher, err := certwatcher.New(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	s := &Server{
+		logger:      logger,
+		opts:        opts,
+		profile:     profile,
+		certWatcher: certWatcher,
+	}
+
+	if opts.ClientCAFile != "" {
+		err = s.loadClientCAs()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Start watches the certificate files for changes until the context is cancelled.
+func (s *Server) Start(ctx context.Context) error {
+	if s.opts.ClientCAFile != "" {
+		go s.watchClientCAs(ctx, 10*time.Second)
+	}
+	return s.certWatcher.Start(ctx)
+}
+
+// TLSConfig returns the TLS configuration of the listener.
+// The configuration is resolved for every connection, therefore changes of the TLS security profile apply to new connections immediately.
+func (s *Server) TLSConfig() *tls.Config {
+	return s.profile.Apply(&tls.Config{
+		GetConfigForClient: s.getConfigForClient,
+	})
+}
+
+func (s *Server) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	config := s.profile.Apply(&tls.Config{
+		GetCertificate: s.certWatcher.GetCertificate,
+	})
+
+	if s.opts.ClientCAFile != "" {
+		s.mu.RLock()
+		config.ClientCAs = s.clientCAs
+		s.mu.RUnlock()
+
+		if s.opts.RequireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			// Clients without a certificate can still authenticate with a bearer token or API key
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	return config, nil
+}
+
+func (s *Server) loadClientCAs() error {
+	caPEM, err := os.ReadFile(s.opts.ClientCAFile)
+	if err != nil {
+		return fmt.Errorf("failed to read client CA file: %w", err)
+	}
+
+	s.mu.RLock()
+	unchanged := bytes.Equal(caPEM, s.clientCAPEM)
+	s.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	clientCAs := x509.NewCertPool()
+	ok := clientCAs.AppendCertsFromPEM(caPEM)
+	if !ok {
+		return fmt.Errorf("no CA found in client CA file %s", s.opts.ClientCAFile)
+	}
+
+	s.mu.Lock()
+	s.clientCAs = clientCAs
+	s.clientCAPEM = caPEM
+	s.mu.Unlock()
+
+	s.logger.Info("loaded client CA bundle", zap.String("file", s.opts.ClientCAFile))
+	return nil
+}
+
+func (s *Server) watchClientCAs(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.loadClientCAs()
+			if err != nil {
+				s.logger.Error("error reloading client CA bundle", zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package traceql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenIdentifier
+	tokenAttribute
+	tokenString
+	tokenNumber
+	tokenDuration
+	tokenOperator
+	tokenPunctuation
+)
+
+// Position is a position in a query. Lines and columns start at 1, columns count characters.
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("line %d, column %d", p.Line, p.Column)
+}
+
+type token struct {
+	typ   tokenType
+	text  string
+	value string // the unquoted value of strings
+	pos   Position
+}
+
+func (t token) is(texts ...string) bool {
+	if t.typ != tokenOperator && t.typ != tokenPunctuation && t.typ != tokenIdentifier {
+		return false
+	}
+	for _, text := range texts {
+		if t.text == text {
+			return true
+		}
+	}
+	return false
+}
+
+func (t token) describe() string {
+	if t.typ == tokenEOF {
+		return "end of query"
+	}
+	return fmt.Sprintf("'%s'", t.text)
+}
+
+// operators are sorted by length, the longest matching operator is used.
+var operators = []string{
+	"!>>", "!<<", "&>>", "&<<",
+	"&&", "||", "!=", ">=", "<=", "=~", "!~", ">>", "<<", "!>", "!<", "&>", "&<", "&~", "==",
+	"=", ">", "<", "!", "~", "+", "-", "*", "/", "%", "^",
+}
+
+var durationUnits = []string{"ns", "us", "µs", "ms", "s", "m", "h"}
+
+type lexer struct {
+	input  string
+	offset int
+	pos    Position
+}
+
+func lex(input string) ([]token, error) {
+	l := &lexer{input: input, pos: Position{Line: 1, Column: 1}}
+	var tokens []token
+	for {
+		t, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+		if t.typ == tokenEOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (l *lexer) peek() rune {
+	r, _ := utf8.DecodeRuneInString(l.input[l.offset:])
+	return r
+}
+
+func (l *lexer) advance() rune {
+	r, size := utf8.DecodeRuneInString(l.input[l.offset:])
+	l.offset += size
+	if r == '\n' {
+		l.pos.Line++
+		l.pos.Column = 1
+	} else {
+		l.pos.Column++
+	}
+	return r
+}
+
+func (l *lexer) rest() string {
+	return l.input[l.offset:]
+}
+
+func (l *lexer) next() (token, error) {
+	for l.offset < len(l.input) && unicode.IsSpace(l.peek()) {
+		l.advance()
+	}
+	start := l.pos
+	startOffset := l.offset
+	if l.offset >= len(l.input) {
+		return token{typ: tokenEOF, pos: start}, nil
+	}
+
+	// Multi-character operators are matched before punctuation, e.g. "||" is not lexed as two pipes
+	op := matchOperator(l.rest())
+	if len(op) > 1 {
+		return l.readOperator(op, start), nil
+	}
+
+	r := l.peek()
+	switch {
+	case strings.ContainsRune("{}(),|", r):
+		l.advance()
+		return token{typ: tokenPunctuation, text: string(r), pos: start}, nil
+	case r == '"' || r == '`':
+		value, err := l.readString()
+		if err != nil {
+			return token{}, err
+		}
+		return token{typ: tokenString, text: l.input[startOffset:l.offset], value: value, pos: start}, nil
+	case r == '\'':
+		return token{}, &SyntaxError{
+			Pos:     start,
+			Message: "unexpected single quote",
+			Fix:     "enclose strings in double quotes or backticks",
+		}
+	case unicode.IsDigit(r) || r == '.' && len(l.rest()) > 1 && unicode.IsDigit(rune(l.rest()[1])):
+		return l.readNumber(start), nil
+	case r == '.' && len(l.rest()) > 1 && (isIdentifierRune(rune(l.rest()[1])) || l.rest()[1] == '"'):
+		return l.readIdentifier(start)
+	case isIdentifierRune(r):
+		return l.readIdentifier(start)
+	}
+
+	if op != "" {
+		return l.readOperator(op, start), nil
+	}
+	return token{}, &SyntaxError{Pos: start, Message: fmt.Sprintf("unexpected character '%c'", r)}
+}
+
+// matchOperator returns the longest operator at the start of the input, or an empty string.
+func matchOperator(input string) string {
+	for _, op := range operators {
+		if strings.HasPrefix(input, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func (l *lexer) readOperator(op string, start Position) token {
+	for range op {
+		l.advance()
+	}
+	return token{typ: tokenOperator, text: op, pos: start}
+}
+
+func (l *lexer) readString() (string, error) {
+	start := l.pos
+	quote := l.advance()
+	var value strings.Builder
+	for l.offset < len(l.input) {
+		r := l.advance()
+		switch {
+		case r == quote:
+			return value.String(), nil
+		case r == '\\' && quote == '"' && l.offset < len(l.input):
+			value.WriteRune(l.advance())
+		default:
+			value.WriteRune(r)
+		}
+	}
+	return "", &SyntaxError{
+		Pos:     start,
+		Message: "unterminated string",
+		Fix:     fmt.Sprintf("add the closing %c", quote),
+	}
+}
+
+func (l *lexer) readNumber(start Position) token {
+	startOffset := l.offset
+	for l.offset < len(l.input) && (unicode.IsDigit(l.peek()) || l.peek() == '.') {
+		l.advance()
+	}
+	number := l.input[startOffset:l.offset]
+
+	// The longest unit which is not followed by another identifier character, e.g. "ms" but not "m" of "ms".
+	unit := ""
+	for _, u := range durationUnits {
+		rest := l.rest()
+		if strings.HasPrefix(rest, u) && len(u) > len(unit) {
+			next, _ := utf8.DecodeRuneInString(rest[len(u):])
+			if len(rest) == len(u) || !isIdentifierRune(next) {
+				unit = u
+			}
+		}
+	}
+	if unit != "" {
+		for range unit {
+			l.advance()
+		}
+		return token{typ: tokenDuration, text: number + unit, pos: start}
+	}
+	return token{typ: tokenNumber, text: number, pos: start}
+}
+
+// readIdentifier reads keywords, intrinsics and attributes. Attributes contain a dot, e.g. ".foo", "span.foo" or span."foo bar".
+func (l *lexer) readIdentifier(start Position) (token, error) {
+	startOffset := l.offset
+	for l.offset < len(l.input) && (isIdentifierRune(l.peek()) || l.peek() == '.' || l.peek() == ':') {
+		l.advance()
+		if strings.HasSuffix(l.input[startOffset:l.offset], ".") && l.peek() == '"' {
+			if _, err := l.readString(); err != nil {
+				return token{}, err
+			}
+			return token{typ: tokenAttribute, text: l.input[startOffset:l.offset], pos: start}, nil
+		}
+	}
+	text := l.input[startOffset:l.offset]
+	if !strings.Contains(text, ".") {
+		return token{typ: tokenIdentifier, text: text, pos: start}, nil
+	}
+
+	// Attribute names may contain dashes and slashes, for example span.k8s.pod-name
+	for l.offset < len(l.input) && (isIdentifierRune(l.peek()) || strings.ContainsRune(".:-/", l.peek())) {
+		l.advance()
+	}
+	return token{typ: tokenAttribute, text: l.input[startOffset:l.offset], pos: start}, nil
+}
+
+func isIdentifierRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
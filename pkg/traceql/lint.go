@@ -0,0 +1,232 @@
+package traceql
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+type SeverityType string
+
+const (
+	SeverityOff    SeverityType = "off"
+	SeverityWarn   SeverityType = "warn"
+	SeverityReject SeverityType = "reject"
+)
+
+const (
+	// LintUnboundedQuery reports queries which match all spans, e.g. {}, without a time range.
+	LintUnboundedQuery = "unbounded-query"
+	// LintHighCardinalityRegex reports regular expressions on high-cardinality attributes.
+	LintHighCardinalityRegex = "high-cardinality-regex"
+)
+
+// DefaultLints are the severities of the lints which are not configured.
+var DefaultLints = map[string]SeverityType{
+	LintUnboundedQuery:       SeverityReject,
+	LintHighCardinalityRegex: SeverityReject,
+}
+
+// DefaultHighCardinalityAttributes are checked by the high-cardinality-regex lint if no attributes are configured.
+var DefaultHighCardinalityAttributes = []string{
+	"trace:id", "span:id", "span:parentID",
+	".http.url", ".url.full", ".http.target", ".db.statement", ".db.query.text",
+}
+
+// Config validates the TraceQL queries of tool calls before they are forwarded to Tempo.
+type Config struct {
+	// Disables the syntax validation and the lints.
+	Disabled bool `json:"disabled,omitempty"`
+	// The severity (off, warn or reject) of each lint.
+	Lints map[string]SeverityType `json:"lints,omitempty"`
+	// Attributes on which regular expressions are reported by the high-cardinality-regex lint, e.g. span.http.url, .http.url (any scope) or trace:id.
+	HighCardinalityAttributes []string `json:"highCardinalityAttributes,omitempty"`
+	// The validated tools and the names of their arguments. Defaults to the TraceQL tools of the Tempo MCP server.
+	Tools map[string]QueryArguments `json:"tools,omitempty"`
+}
+
+// QueryArguments are the names of the arguments of a tool with a TraceQL query.
+type QueryArguments struct {
+	Query string `json:"query"`
+	// The start of the time range. Queries without a start are unbounded.
+	Start string `json:"start,omitempty"`
+	// True if the tool requires a metrics query, false if the tool does not accept metrics queries.
+	Metrics bool `json:"metrics,omitempty"`
+}
+
+// DefaultTools are the TraceQL tools of the Tempo MCP server.
+var DefaultTools = map[string]QueryArguments{
+	"traceql-search":          {Query: "query", Start: "start"},
+	"traceql-metrics-instant": {Query: "query", Start: "start", Metrics: true},
+	"traceql-metrics-range":   {Query: "query", Start: "start", Metrics: true},
+}
+
+// LintError is returned if a lint with severity reject reports a query.
+type LintError struct {
+	Lint    string
+	Message string
+}
+
+func (e *LintError) Error() string {
+	return fmt.Sprintf("the query was rejected by the %s lint: %s", e.Lint, e.Message)
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	for _, lint := range slices.Sorted(maps.Keys(c.Lints)) {
+		if _, ok := DefaultLints[lint]; !ok {
+			errs = append(errs, fmt.Errorf("lints: unknown lint %q, expected one of %v", lint, slices.Sorted(maps.Keys(DefaultLints))))
+		}
+		switch c.Lints[lint] {
+		case SeverityOff, SeverityWarn, SeverityReject:
+		default:
+			errs = append(errs, fmt.Errorf("lints[%s]: invalid severity %q, expected %s, %s or %s", lint, c.Lints[lint], SeverityOff, SeverityWarn, SeverityReject))
+		}
+	}
+	for _, tool := range slices.Sorted(maps.Keys(c.Tools)) {
+		if c.Tools[tool].Query == "" {
+			errs = append(errs, fmt.Errorf("tools[%s].query: must not be empty", tool))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c Config) severity(lint string) SeverityType {
+	if severity, ok := c.Lints[lint]; ok {
+		return severity
+	}
+	return DefaultLints[lint]
+}
+
+// Check validates the TraceQL query of a tool call and runs the lints.
+// It returns the warnings of lints with severity warn, a SyntaxError for invalid queries, and a LintError for rejected queries.
+// Tool calls without a query are not checked, the Tempo MCP server reports missing arguments.
+func (c Config) Check(tool string, args map[string]any) ([]string, error) {
+	if c.Disabled {
+		return nil, nil
+	}
+	tools := c.Tools
+	if tools == nil {
+		tools = DefaultTools
+	}
+	toolArgs, ok := tools[tool]
+	if !ok {
+		return nil, nil
+	}
+	queryString, ok := args[toolArgs.Query].(string)
+	if !ok {
+		return nil, nil
+	}
+
+	query, err := Parse(queryString)
+	if err != nil {
+		return nil, err
+	}
+	if toolArgs.Metrics && !query.Metrics {
+		return nil, &SyntaxError{
+			Pos:     Position{Line: 1, Column: 1},
+			Message: fmt.Sprintf("the %s tool requires a metrics query", tool),
+			Fix:     "add a metrics function, e.g. " + queryString + " | rate()",
+		}
+	}
+	if !toolArgs.Metrics && query.Metrics {
+		return nil, &SyntaxError{
+			Pos:     Position{Line: 1, Column: 1},
+			Message: fmt.Sprintf("the %s tool does not accept metrics queries", tool),
+			Fix:     "use a metrics tool, e.g. traceql-metrics-range",
+		}
+	}
+
+	var warnings []string
+	report := func(lint string, message string) error {
+		switch c.severity(lint) {
+		case SeverityWarn:
+			warnings = append(warnings, fmt.Sprintf("%s: %s", lint, message))
+		case SeverityReject:
+			return &LintError{Lint: lint, Message: message}
+		}
+		return nil
+	}
+
+	_, hasStart := args[toolArgs.Start]
+	if toolArgs.Start != "" && !hasStart && query.matchesAll() {
+		err := report(LintUnboundedQuery, "the query matches all spans and has no time range, add a condition or a start time")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	attributes := c.HighCardinalityAttributes
+	if attributes == nil {
+		attributes = DefaultHighCardinalityAttributes
+	}
+	for _, filter := range query.Filters {
+		for _, attr := range regexAttributes(filter.Expr) {
+			if !matchesAny(attr, attributes) {
+				continue
+			}
+			err := report(LintHighCardinalityRegex, fmt.Sprintf("regular expression on the high-cardinality attribute %s at %s, use an exact match (=) instead", attr.String(), attr.Pos))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// matchesAll returns true if all spanset filters of the query match all spans.
+func (q *Query) matchesAll() bool {
+	for _, filter := range q.Filters {
+		literal, ok := filter.Expr.(*Literal)
+		if filter.Expr != nil && !(ok && literal.Value == "true") {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *Attribute) String() string {
+	if a.Intrinsic {
+		return a.Name
+	}
+	return a.Scope + "." + a.Name
+}
+
+// regexAttributes returns the attributes which are compared with a regular expression.
+func regexAttributes(expr Expr) []*Attribute {
+	switch e := expr.(type) {
+	case *BinaryExpr:
+		if e.Op == "=~" || e.Op == "!~" {
+			var attrs []*Attribute
+			for _, side := range []Expr{e.LHS, e.RHS} {
+				if attr, ok := side.(*Attribute); ok {
+					attrs = append(attrs, attr)
+				}
+			}
+			return attrs
+		}
+		return append(regexAttributes(e.LHS), regexAttributes(e.RHS)...)
+	case *UnaryExpr:
+		return regexAttributes(e.Expr)
+	}
+	return nil
+}
+
+// matchesAny returns true if the attribute matches one of the configured attributes.
+// Unscoped attributes (.foo) match attributes of any scope.
+func matchesAny(attr *Attribute, attributes []string) bool {
+	for _, configured := range attributes {
+		if attr.Intrinsic {
+			if configured == attr.Name {
+				return true
+			}
+			continue
+		}
+		scope, name, ok := splitAttribute(configured)
+		if ok && name == attr.Name && (scope == "" || attr.Scope == "" || scope == attr.Scope) {
+			return true
+		}
+	}
+	return false
+}
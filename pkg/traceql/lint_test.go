@@ -0,0 +1,105 @@
+package traceql
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		tool     string
+		args     map[string]any
+		warnings []string
+		lint     string
+		syntax   bool
+	}{
+		{
+			name: "valid query with ||",
+			tool: "traceql-search",
+			args: map[string]any{"query": `{ span.a = 1 || span.b = 2 } || { .c = 3 }`},
+		},
+		{
+			name: "tool without query",
+			tool: "get-trace",
+			args: map[string]any{"traceId": "abc"},
+		},
+		{
+			name:   "syntax error",
+			tool:   "traceql-search",
+			args:   map[string]any{"query": `{ span.a == 1 }`},
+			syntax: true,
+		},
+		{
+			name: "unbounded query",
+			tool: "traceql-search",
+			args: map[string]any{"query": `{}`},
+			lint: LintUnboundedQuery,
+		},
+		{
+			name: "query with start is bounded",
+			tool: "traceql-search",
+			args: map[string]any{"query": `{ true }`, "start": "2026-10-01T00:00:00Z"},
+		},
+		{
+			name: "high-cardinality regex",
+			tool: "traceql-search",
+			args: map[string]any{"query": `{ .service.name = "a" && span.http.url =~ ".*/api" }`},
+			lint: LintHighCardinalityRegex,
+		},
+		{
+			name:     "warn",
+			config:   Config{Lints: map[string]SeverityType{LintHighCardinalityRegex: SeverityWarn}},
+			tool:     "traceql-search",
+			args:     map[string]any{"query": `{ trace:id =~ "abc.*" }`},
+			warnings: []string{"high-cardinality-regex: regular expression on the high-cardinality attribute trace:id at line 1, column 3, use an exact match (=) instead"},
+		},
+		{
+			name:   "configured attributes",
+			config: Config{HighCardinalityAttributes: []string{"span.user.id"}},
+			tool:   "traceql-search",
+			args:   map[string]any{"query": `{ span.http.url =~ "x" && .user.id =~ "y" }`},
+			lint:   LintHighCardinalityRegex,
+		},
+		{
+			name:   "disabled",
+			config: Config{Disabled: true},
+			tool:   "traceql-search",
+			args:   map[string]any{"query": `{`},
+		},
+		{
+			name:   "metrics tool requires a metrics query",
+			tool:   "traceql-metrics-range",
+			args:   map[string]any{"query": `{ .a = 1 }`},
+			syntax: true,
+		},
+		{
+			name:   "search tool does not accept metrics queries",
+			tool:   "traceql-search",
+			args:   map[string]any{"query": `{ .a = 1 } | rate()`},
+			syntax: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			warnings, err := tc.config.Check(tc.tool, tc.args)
+
+			var lintErr *LintError
+			var syntaxErr *SyntaxError
+			switch {
+			case tc.lint != "":
+				require.True(t, errors.As(err, &lintErr), "expected a lint error, got %v", err)
+				require.Equal(t, tc.lint, lintErr.Lint)
+			case tc.syntax:
+				require.True(t, errors.As(err, &syntaxErr), "expected a syntax error, got %v", err)
+			default:
+				require.NoError(t, err)
+				require.Equal(t, tc.warnings, warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,617 @@
+package traceql
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// SyntaxError is an invalid query, with the position of the error and a suggested fix.
+type SyntaxError struct {
+	Pos     Position
+	Message string
+	// A suggested fix, if known.
+	Fix string
+}
+
+func (e *SyntaxError) Error() string {
+	msg := fmt.Sprintf("TraceQL syntax error at %s: %s", e.Pos, e.Message)
+	if e.Fix != "" {
+		msg += " (fix: " + e.Fix + ")"
+	}
+	return msg
+}
+
+// Query is a parsed TraceQL query. Only the parts which are required by the lints are kept.
+type Query struct {
+	// The spanset filters of the query, e.g. { span.foo = "bar" }.
+	Filters []*Filter
+	// True if the query contains a metrics function, e.g. rate().
+	Metrics bool
+}
+
+type Filter struct {
+	Pos Position
+	// The field expression of the filter, nil for {}.
+	Expr Expr
+}
+
+// Expr is a field expression.
+type Expr interface {
+	Position() Position
+}
+
+type BinaryExpr struct {
+	Pos Position
+	Op  string
+	LHS Expr
+	RHS Expr
+}
+
+type UnaryExpr struct {
+	Pos  Position
+	Op   string
+	Expr Expr
+}
+
+// Attribute is an attribute (span.foo, .foo) or intrinsic (duration, span:name).
+type Attribute struct {
+	Pos Position
+	// The scope of an attribute, e.g. span, resource or parent.span. Empty for unscoped attributes and intrinsics.
+	Scope string
+	Name  string
+	// True for intrinsics.
+	Intrinsic bool
+}
+
+// Literal is a string, number, duration or static value (true, nil, ok, server, ...).
+type Literal struct {
+	Pos   Position
+	Value string
+}
+
+func (e *BinaryExpr) Position() Position { return e.Pos }
+func (e *UnaryExpr) Position() Position  { return e.Pos }
+func (e *Attribute) Position() Position  { return e.Pos }
+func (e *Literal) Position() Position    { return e.Pos }
+
+var intrinsics = []string{
+	"duration", "name", "status", "statusMessage", "kind", "rootName", "rootServiceName", "traceDuration",
+	"childCount", "nestedSetLeft", "nestedSetRight", "nestedSetParent", "parent",
+	"span:duration", "span:name", "span:kind", "span:status", "span:statusMessage", "span:id", "span:parentID", "span:childCount",
+	"trace:duration", "trace:rootName", "trace:rootService", "trace:id",
+	"event:name", "event:timeSinceStart", "link:traceID", "link:spanID",
+	"instrumentation:name", "instrumentation:version",
+}
+
+var staticValues = []string{
+	"true", "false", "nil",
+	"ok", "error", "unset",
+	"unspecified", "internal", "server", "client", "producer", "consumer",
+}
+
+var scopes = []string{"span", "resource", "event", "link", "instrumentation", "parent", "parent.span", "parent.resource"}
+
+var aggregates = []string{"count", "avg", "min", "max", "sum"}
+
+// metricsFunctions maps the metrics functions to their minimum and maximum number of arguments (-1 for unlimited).
+var metricsFunctions = map[string][2]int{
+	"rate":                {0, 0},
+	"count_over_time":     {0, 0},
+	"min_over_time":       {1, 1},
+	"max_over_time":       {1, 1},
+	"avg_over_time":       {1, 1},
+	"sum_over_time":       {1, 1},
+	"histogram_over_time": {1, 1},
+	"quantile_over_time":  {2, -1},
+	"compare":             {1, 4},
+}
+
+var spansetOperators = []string{"&&", "||", ">", ">>", "<", "<<", "~", "!>", "!>>", "!<", "!<<", "!~", "&>", "&>>", "&<", "&<<", "&~"}
+
+var comparisonOperators = []string{"=", "!=", ">", ">=", "<", "<=", "=~", "!~"}
+
+// splitAttribute splits an attribute into its scope and name, e.g. span.foo into span and foo, and .foo into an empty scope and foo.
+func splitAttribute(text string) (string, string, bool) {
+	if name, ok := strings.CutPrefix(text, "."); ok {
+		return "", unquote(name), true
+	}
+	// The longest matching scope, e.g. parent.span instead of parent
+	for _, scope := range slices.Backward(scopes) {
+		if name, ok := strings.CutPrefix(text, scope+"."); ok && name != "" {
+			return scope, unquote(name), true
+		}
+	}
+	return "", text, false
+}
+
+func unquote(name string) string {
+	if len(name) >= 2 && name[0] == '"' && name[len(name)-1] == '"' {
+		return strings.ReplaceAll(name[1:len(name)-1], `\"`, `"`)
+	}
+	return name
+}
+
+type parser struct {
+	tokens []token
+	i      int
+	query  *Query
+}
+
+// Parse parses a TraceQL query.
+func Parse(query string) (*Query, error) {
+	tokens, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, query: &Query{}}
+	if p.peek().typ == tokenEOF {
+		return nil, &SyntaxError{Pos: p.peek().pos, Message: "empty query", Fix: "select all spans with {}"}
+	}
+	if err := p.parsePipeline(); err != nil {
+		return nil, err
+	}
+	if p.peek().is("with") {
+		if err := p.parseHints(); err != nil {
+			return nil, err
+		}
+	}
+	if t := p.peek(); t.typ != tokenEOF {
+		if t.is("}") {
+			return nil, &SyntaxError{Pos: t.pos, Message: "unexpected '}'", Fix: "remove the '}' or add the missing '{'"}
+		}
+		if t.is(")") {
+			return nil, &SyntaxError{Pos: t.pos, Message: "unexpected ')'", Fix: "remove the ')' or add the missing '('"}
+		}
+		return nil, p.unexpected(t, "'|' or a spanset operator such as '&&'")
+	}
+	return p.query, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.typ != tokenEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) expect(text string, fix string) (token, error) {
+	t := p.next()
+	if !t.is(text) {
+		return t, &SyntaxError{Pos: t.pos, Message: fmt.Sprintf("expected '%s', got %s", text, t.describe()), Fix: fix}
+	}
+	return t, nil
+}
+
+func (p *parser) unexpected(t token, expected string) *SyntaxError {
+	err := &SyntaxError{Pos: t.pos, Message: fmt.Sprintf("unexpected %s, expected %s", t.describe(), expected)}
+	switch {
+	case t.is("=="):
+		err.Fix = "use '=' to compare values"
+	case t.typ == tokenIdentifier && strings.EqualFold(t.text, "and"):
+		err.Fix = "use '&&'"
+	case t.typ == tokenIdentifier && strings.EqualFold(t.text, "or"):
+		err.Fix = "use '||'"
+	}
+	return err
+}
+
+// parsePipeline parses spanset expressions and pipeline stages separated by '|'.
+func (p *parser) parsePipeline() error {
+	if err := p.parseSpansetExpr(); err != nil {
+		return err
+	}
+
+	for p.peek().is("|") {
+		pipe := p.next()
+		t := p.peek()
+		if t.typ == tokenEOF || t.is(")") {
+			return &SyntaxError{Pos: pipe.pos, Message: "missing pipeline stage after '|'", Fix: "remove the trailing '|' or add a stage such as count() > 1"}
+		}
+		if p.query.Metrics && !t.is("topk", "bottomk") {
+			return &SyntaxError{Pos: t.pos, Message: "only topk() or bottomk() may follow a metrics function", Fix: "move the filter before the metrics function"}
+		}
+		if err := p.parseStage(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseStage() error {
+	t := p.peek()
+	switch {
+	case t.is("{", "("):
+		return p.parseSpansetExpr()
+	case t.typ == tokenIdentifier && slices.Contains(aggregates, t.text):
+		return p.parseScalarFilter()
+	case t.is("select", "by"):
+		p.next()
+		return p.parseArguments(t, 1, -1, p.parseFieldArgument)
+	case t.is("coalesce"):
+		p.next()
+		return p.parseArguments(t, 0, 0, nil)
+	case t.is("topk", "bottomk"):
+		if !p.query.Metrics {
+			return &SyntaxError{Pos: t.pos, Message: fmt.Sprintf("%s() requires a metrics function", t.text), Fix: "add a metrics function such as rate() by (resource.service.name) before it"}
+		}
+		p.next()
+		return p.parseArguments(t, 1, 1, p.parseNumberArgument)
+	case t.typ == tokenIdentifier:
+		if limits, ok := metricsFunctions[t.text]; ok {
+			return p.parseMetrics(t, limits)
+		}
+	}
+
+	err := &SyntaxError{Pos: t.pos, Message: fmt.Sprintf("unexpected %s, expected a spanset filter, aggregate or metrics function", t.describe())}
+	if t.typ == tokenIdentifier {
+		known := append(append(slices.Clone(aggregates), "select", "by", "coalesce", "topk", "bottomk"), slices.Sorted(maps.Keys(metricsFunctions))...)
+		if suggestion := closest(t.text, known); suggestion != "" {
+			err.Fix = fmt.Sprintf("did you mean %s()?", suggestion)
+		}
+	}
+	return err
+}
+
+// parseSpansetExpr parses spanset filters combined with spanset operators, e.g. { a } && ({ b } | count() > 1).
+func (p *parser) parseSpansetExpr() error {
+	for {
+		t := p.next()
+		switch {
+		case t.is("{"):
+			if err := p.parseFilter(t); err != nil {
+				return err
+			}
+		case t.is("("):
+			if err := p.parsePipeline(); err != nil {
+				return err
+			}
+			if _, err := p.expect(")", fmt.Sprintf("add ')' to close the '(' at %s", t.pos)); err != nil {
+				return err
+			}
+		default:
+			err := p.unexpected(t, "a spanset filter such as { span.foo = \"bar\" }")
+			if t.typ == tokenAttribute || t.typ == tokenIdentifier {
+				err.Fix = "enclose conditions in curly braces, e.g. { " + t.text + " ... }"
+			}
+			return err
+		}
+
+		if !p.peek().is(spansetOperators...) {
+			return nil
+		}
+		p.next()
+	}
+}
+
+func (p *parser) parseFilter(open token) error {
+	filter := &Filter{Pos: open.pos}
+	p.query.Filters = append(p.query.Filters, filter)
+	if p.peek().is("}") {
+		p.next()
+		return nil
+	}
+
+	expr, err := p.parseExpr(0)
+	if err != nil {
+		return err
+	}
+	filter.Expr = expr
+
+	t := p.next()
+	if !t.is("}") {
+		if t.typ == tokenEOF {
+			return &SyntaxError{Pos: t.pos, Message: "unterminated spanset filter", Fix: fmt.Sprintf("add '}' to close the '{' at %s", open.pos)}
+		}
+		return p.unexpected(t, "'}' or an operator such as '&&'")
+	}
+	return nil
+}
+
+// binaryPrecedence of field expression operators, higher values bind stronger.
+var binaryPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"=":  3, "!=": 3, ">": 3, ">=": 3, "<": 3, "<=": 3, "=~": 3, "!~": 3,
+	"+": 4, "-": 4,
+	"*": 5, "/": 5, "%": 5,
+	"^": 6,
+}
+
+// parseExpr parses a field expression with operators of at least the given precedence.
+func (p *parser) parseExpr(minPrecedence int) (Expr, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		if t.is("==") {
+			return nil, &SyntaxError{Pos: t.pos, Message: "unexpected '=='", Fix: "use '=' to compare values"}
+		}
+		precedence, ok := binaryPrecedence[t.text]
+		if t.typ != tokenOperator || !ok || precedence < minPrecedence {
+			if t.typ == tokenIdentifier && (strings.EqualFold(t.text, "and") || strings.EqualFold(t.text, "or")) {
+				return nil, p.unexpected(t, "an operator")
+			}
+			return lhs, nil
+		}
+		p.next()
+
+		// ^ is right associative
+		next := precedence + 1
+		if t.text == "^" {
+			next = precedence
+		}
+		rhs, err := p.parseExpr(next)
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{Pos: t.pos, Op: t.text, LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	t := p.peek()
+	if t.is("!", "-") {
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Pos: t.pos, Op: t.text, Expr: expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.next()
+	switch t.typ {
+	case tokenString, tokenNumber, tokenDuration:
+		return &Literal{Pos: t.pos, Value: t.text}, nil
+	case tokenAttribute:
+		scope, name, ok := splitAttribute(t.text)
+		if !ok {
+			return nil, &SyntaxError{
+				Pos:     t.pos,
+				Message: fmt.Sprintf("attribute '%s' has no scope", t.text),
+				Fix:     fmt.Sprintf("use '.%s' for any scope, or a scope such as 'span.%s' or 'resource.%s'", t.text, t.text, t.text),
+			}
+		}
+		return &Attribute{Pos: t.pos, Scope: scope, Name: name}, nil
+	case tokenIdentifier:
+		if slices.Contains(intrinsics, t.text) {
+			return &Attribute{Pos: t.pos, Name: t.text, Intrinsic: true}, nil
+		}
+		if slices.Contains(staticValues, t.text) {
+			return &Literal{Pos: t.pos, Value: t.text}, nil
+		}
+		return nil, p.unknownIdentifier(t)
+	}
+
+	if t.is("(") {
+		expr, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(")", fmt.Sprintf("add ')' to close the '(' at %s", t.pos)); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+	if t.is("}") && p.i >= 2 && p.tokens[p.i-2].typ == tokenOperator {
+		return nil, &SyntaxError{Pos: t.pos, Message: fmt.Sprintf("missing value after '%s'", p.tokens[p.i-2].text)}
+	}
+	return nil, p.unexpected(t, "an attribute, intrinsic or value")
+}
+
+func (p *parser) unknownIdentifier(t token) *SyntaxError {
+	err := &SyntaxError{Pos: t.pos, Message: fmt.Sprintf("unknown identifier '%s'", t.text)}
+
+	previous := token{}
+	if p.i >= 2 {
+		previous = p.tokens[p.i-2]
+	}
+	switch {
+	case strings.EqualFold(t.text, "and"):
+		err.Fix = "use '&&'"
+	case strings.EqualFold(t.text, "or"):
+		err.Fix = "use '||'"
+	case strings.EqualFold(t.text, "not"):
+		err.Fix = "use '!'"
+	case previous.typ == tokenOperator && slices.Contains(comparisonOperators, previous.text):
+		if suggestion := closest(t.text, staticValues); suggestion != "" {
+			err.Fix = fmt.Sprintf("did you mean %s? Use \"%s\" for a string value", suggestion, t.text)
+		} else {
+			err.Fix = fmt.Sprintf("use \"%s\" for a string value", t.text)
+		}
+	default:
+		if suggestion := closest(t.text, intrinsics); suggestion != "" {
+			err.Fix = fmt.Sprintf("did you mean the intrinsic %s? Use '.%s' for an attribute", suggestion, t.text)
+		} else {
+			err.Fix = fmt.Sprintf("use '.%s' for an attribute", t.text)
+		}
+	}
+	return err
+}
+
+// parseScalarFilter parses an aggregate compared to a value, e.g. count() > 1 or avg(duration) > 1s.
+func (p *parser) parseScalarFilter() error {
+	aggregate := p.next()
+	minArgs, maxArgs := 1, 1
+	if aggregate.text == "count" {
+		minArgs, maxArgs = 0, 0
+	}
+	if err := p.parseArguments(aggregate, minArgs, maxArgs, p.parseFieldArgument); err != nil {
+		return err
+	}
+
+	t := p.next()
+	if !t.is(comparisonOperators...) {
+		err := p.unexpected(t, "a comparison operator")
+		if !t.is("==") {
+			err.Fix = fmt.Sprintf("compare the aggregate to a value, e.g. %s() > 1", aggregate.text)
+		}
+		return err
+	}
+	_, err := p.parseExpr(4)
+	return err
+}
+
+func (p *parser) parseMetrics(function token, limits [2]int) error {
+	p.next()
+	p.query.Metrics = true
+
+	argument := p.parseFieldArgument
+	if function.text == "compare" {
+		argument = func(i int) error {
+			if i == 0 {
+				t := p.next()
+				if !t.is("{") {
+					return p.unexpected(t, "a spanset filter")
+				}
+				return p.parseFilter(t)
+			}
+			return p.parseNumberArgument(i)
+		}
+	} else if function.text == "quantile_over_time" {
+		argument = func(i int) error {
+			if i == 0 {
+				return p.parseFieldArgument(i)
+			}
+			return p.parseNumberArgument(i)
+		}
+	}
+	if err := p.parseArguments(function, limits[0], limits[1], argument); err != nil {
+		return err
+	}
+
+	if p.peek().is("by") {
+		by := p.next()
+		if err := p.parseArguments(by, 1, -1, p.parseFieldArgument); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseHints parses query hints, e.g. with (sample=true).
+func (p *parser) parseHints() error {
+	with := p.next()
+	return p.parseArguments(with, 1, -1, func(int) error {
+		t := p.next()
+		if t.typ != tokenIdentifier {
+			return p.unexpected(t, "a hint name")
+		}
+		if _, err := p.expect("=", "set hints with name=value"); err != nil {
+			return err
+		}
+		_, err := p.parsePrimary()
+		return err
+	})
+}
+
+// parseArguments parses the parenthesized arguments of a function.
+func (p *parser) parseArguments(function token, minArgs int, maxArgs int, argument func(int) error) error {
+	open, err := p.expect("(", fmt.Sprintf("call the function with %s()", function.text))
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	if !p.peek().is(")") {
+		for {
+			if maxArgs >= 0 && n >= maxArgs {
+				return p.argumentCountError(function, minArgs, maxArgs, p.peek())
+			}
+			if err := argument(n); err != nil {
+				return err
+			}
+			n++
+			if !p.peek().is(",") {
+				break
+			}
+			p.next()
+		}
+	}
+
+	t := p.next()
+	if !t.is(")") {
+		if t.typ == tokenEOF {
+			return &SyntaxError{Pos: t.pos, Message: "unterminated argument list", Fix: fmt.Sprintf("add ')' to close the '(' at %s", open.pos)}
+		}
+		return p.unexpected(t, "',' or ')'")
+	}
+	if n < minArgs {
+		return p.argumentCountError(function, minArgs, maxArgs, t)
+	}
+	return nil
+}
+
+func (p *parser) argumentCountError(function token, minArgs int, maxArgs int, at token) error {
+	var expected string
+	switch {
+	case minArgs == maxArgs:
+		expected = fmt.Sprintf("%d arguments", minArgs)
+	case maxArgs < 0:
+		expected = fmt.Sprintf("at least %d arguments", minArgs)
+	default:
+		expected = fmt.Sprintf("%d to %d arguments", minArgs, maxArgs)
+	}
+	return &SyntaxError{Pos: at.pos, Message: fmt.Sprintf("%s() takes %s", function.text, expected)}
+}
+
+func (p *parser) parseFieldArgument(int) error {
+	_, err := p.parseExpr(0)
+	return err
+}
+
+func (p *parser) parseNumberArgument(int) error {
+	t := p.next()
+	if t.typ != tokenNumber {
+		return p.unexpected(t, "a number")
+	}
+	return nil
+}
+
+// closest returns the candidate with the smallest edit distance to s, if the distance is small compared to the length of s.
+func closest(s string, candidates []string) string {
+	best := ""
+	bestDistance := max(1, min(len(s)/3, 2)) + 1
+	for _, candidate := range candidates {
+		if d := editDistance(strings.ToLower(s), strings.ToLower(candidate)); d < bestDistance {
+			best = candidate
+			bestDistance = d
+		}
+	}
+	return best
+}
+
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
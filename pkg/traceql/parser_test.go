@@ -0,0 +1,248 @@
+package traceql
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseValid(t *testing.T) {
+	tests := []struct {
+		query   string
+		filters int
+		metrics bool
+	}{
+		{query: `{}`, filters: 1},
+		{query: `{ true }`, filters: 1},
+		{query: `{ span.http.status_code = 500 }`, filters: 1},
+		{query: `{ .service.name = "frontend" && duration > 1.5s }`, filters: 1},
+		{query: `{ span.a = 1 || span.b = 2 }`, filters: 1},
+		{query: `{ (span.a = 1 || span.b = 2) && status = error }`, filters: 1},
+		{query: `{ !(span.a = 1) && kind != server }`, filters: 1},
+		{query: `{ span.a = 1 }||{ span.b = 2 }`, filters: 2},
+		{query: `{ .a } || { .b }`, filters: 2},
+		{query: `{ resource.service.name = "a" } >> { span.db.system = "redis" }`, filters: 2},
+		{query: `{ .a = 1 } !>> { .b = 2 } &< { .c = 3 }`, filters: 3},
+		{query: `({ .a = 1 } | count() > 2) && { .b = 2 }`, filters: 2},
+		{query: `{ span."name with spaces" = "x" && span.k8s.pod-name =~ "api-.*" }`, filters: 1},
+		{query: `{ duration > .5s } | avg(duration) > 100ms`, filters: 1},
+		{query: `{ span.size * 2 + 1 ^ 2 ^ 3 >= -10 }`, filters: 1},
+		{query: `{ trace:rootService = "a" && span:name = "b" && event:name = "c" }`, filters: 1},
+		{query: `{ .a = 1 } | select(span.b, resource.c)`, filters: 1},
+		{query: `{ .a = 1 } | by(resource.service.name) | count() > 1 | coalesce()`, filters: 1},
+		{query: "{ .a = `raw \\ string` }\n| count() > 1", filters: 1},
+		{query: `{ status = error } | rate() by (resource.service.name)`, filters: 1, metrics: true},
+		{query: `{} | quantile_over_time(duration, .5, .99) by (span.name) | topk(5)`, filters: 1, metrics: true},
+		{query: `{} | compare({ status = error }, 10)`, filters: 2, metrics: true},
+		{query: `{} | rate() with (sample = true)`, filters: 1, metrics: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			query, err := Parse(tc.query)
+			require.NoError(t, err)
+			require.Len(t, query.Filters, tc.filters)
+			require.Equal(t, tc.metrics, query.Metrics)
+		})
+	}
+}
+
+func TestParseOr(t *testing.T) {
+	query, err := Parse(`{ span.a = 1 || span.b = 2 && span.c = 3 }`)
+	require.NoError(t, err)
+
+	// && binds stronger than ||
+	or, ok := query.Filters[0].Expr.(*BinaryExpr)
+	require.True(t, ok)
+	require.Equal(t, "||", or.Op)
+	and, ok := or.RHS.(*BinaryExpr)
+	require.True(t, ok)
+	require.Equal(t, "&&", and.Op)
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		query   string
+		pos     Position
+		message string
+		fix     string
+	}{
+		{
+			query:   ``,
+			pos:     Position{Line: 1, Column: 1},
+			message: "empty query",
+			fix:     "select all spans with {}",
+		},
+		{
+			query:   `{ span.a == 1 }`,
+			pos:     Position{Line: 1, Column: 10},
+			message: "unexpected '=='",
+			fix:     "use '=' to compare values",
+		},
+		{
+			query:   `{ span.a = 1 and span.b = 2 }`,
+			pos:     Position{Line: 1, Column: 14},
+			message: "unexpected 'and', expected an operator",
+			fix:     "use '&&'",
+		},
+		{
+			query:   `{ span.a = 1 } or { span.b = 2 }`,
+			pos:     Position{Line: 1, Column: 16},
+			message: "unexpected 'or', expected '|' or a spanset operator such as '&&'",
+			fix:     "use '||'",
+		},
+		{
+			query:   `{ span.a = 'x' }`,
+			pos:     Position{Line: 1, Column: 12},
+			message: "unexpected single quote",
+			fix:     "enclose strings in double quotes or backticks",
+		},
+		{
+			query:   `{ span.a = "x }`,
+			pos:     Position{Line: 1, Column: 12},
+			message: "unterminated string",
+			fix:     `add the closing "`,
+		},
+		{
+			query:   `{ span.a = 1`,
+			pos:     Position{Line: 1, Column: 13},
+			message: "unterminated spanset filter",
+			fix:     "add '}' to close the '{' at line 1, column 1",
+		},
+		{
+			query:   `{ span.a = 1 }}`,
+			pos:     Position{Line: 1, Column: 15},
+			message: "unexpected '}'",
+			fix:     "remove the '}' or add the missing '{'",
+		},
+		{
+			query:   `{ span.a = }`,
+			pos:     Position{Line: 1, Column: 12},
+			message: "missing value after '='",
+		},
+		{
+			query:   `{ foo = 1 }`,
+			pos:     Position{Line: 1, Column: 3},
+			message: "unknown identifier 'foo'",
+			fix:     "use '.foo' for an attribute",
+		},
+		{
+			query:   `{ duraton > 1s }`,
+			pos:     Position{Line: 1, Column: 3},
+			message: "unknown identifier 'duraton'",
+			fix:     "did you mean the intrinsic duration? Use '.duraton' for an attribute",
+		},
+		{
+			query:   `{ status = eror }`,
+			pos:     Position{Line: 1, Column: 12},
+			message: "unknown identifier 'eror'",
+			fix:     `did you mean error? Use "eror" for a string value`,
+		},
+		{
+			query:   `span.a = 1`,
+			pos:     Position{Line: 1, Column: 1},
+			message: `unexpected 'span.a', expected a spanset filter such as { span.foo = "bar" }`,
+			fix:     "enclose conditions in curly braces, e.g. { span.a ... }",
+		},
+		{
+			query:   `{ .a = 1 } |`,
+			pos:     Position{Line: 1, Column: 12},
+			message: "missing pipeline stage after '|'",
+			fix:     "remove the trailing '|' or add a stage such as count() > 1",
+		},
+		{
+			query:   `{ .a = 1 } | cont() > 1`,
+			pos:     Position{Line: 1, Column: 14},
+			message: "unexpected 'cont', expected a spanset filter, aggregate or metrics function",
+			fix:     "did you mean count()?",
+		},
+		{
+			query:   `{ .a = 1 } | count > 1`,
+			pos:     Position{Line: 1, Column: 20},
+			message: "expected '(', got '>'",
+			fix:     "call the function with count()",
+		},
+		{
+			query:   `{} | rate(duration)`,
+			pos:     Position{Line: 1, Column: 11},
+			message: "rate() takes 0 arguments",
+		},
+		{
+			query:   `{} | rate() | count() > 1`,
+			pos:     Position{Line: 1, Column: 15},
+			message: "only topk() or bottomk() may follow a metrics function",
+			fix:     "move the filter before the metrics function",
+		},
+		{
+			query:   "{ .a = 1 }\n| topk(5)",
+			pos:     Position{Line: 2, Column: 3},
+			message: "topk() requires a metrics function",
+			fix:     "add a metrics function such as rate() by (resource.service.name) before it",
+		},
+		{
+			query:   `{ (.a = 1 }`,
+			pos:     Position{Line: 1, Column: 11},
+			message: "expected ')', got '}'",
+			fix:     "add ')' to close the '(' at line 1, column 3",
+		},
+		{
+			query:   `{ a = 1 }`,
+			pos:     Position{Line: 1, Column: 3},
+			message: "unknown identifier 'a'",
+			fix:     "use '.a' for an attribute",
+		},
+		{
+			query:   `{ .a = 1 } | by(resource.service.name`,
+			pos:     Position{Line: 1, Column: 38},
+			message: "unterminated argument list",
+			fix:     "add ')' to close the '(' at line 1, column 16",
+		},
+		{
+			query:   `{ .a = 1 # }`,
+			pos:     Position{Line: 1, Column: 10},
+			message: "unexpected character '#'",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			_, err := Parse(tc.query)
+			var syntaxErr *SyntaxError
+			require.True(t, errors.As(err, &syntaxErr), "expected a syntax error, got %v", err)
+			require.Equal(t, tc.pos, syntaxErr.Pos)
+			require.Equal(t, tc.message, syntaxErr.Message)
+			require.Equal(t, tc.fix, syntaxErr.Fix)
+		})
+	}
+}
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{input: `a || b`, want: []string{"a", "||", "b"}},
+		{input: `a|b`, want: []string{"a", "|", "b"}},
+		{input: `} | {`, want: []string{"}", "|", "{"}},
+		{input: `}||{`, want: []string{"}", "||", "{"}},
+		{input: `!>> &<< =~ !~ != >= <=`, want: []string{"!>>", "&<<", "=~", "!~", "!=", ">=", "<="}},
+		{input: `1.5ms 10 .5 2h`, want: []string{"1.5ms", "10", ".5", "2h"}},
+		{input: `span.k8s.pod-name parent.span.foo trace:id`, want: []string{"span.k8s.pod-name", "parent.span.foo", "trace:id"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			tokens, err := lex(tc.input)
+			require.NoError(t, err)
+
+			var texts []string
+			for _, token := range tokens {
+				if token.typ != tokenEOF {
+					texts = append(texts, token.text)
+				}
+			}
+			require.Equal(t, tc.want, texts)
+		})
+	}
+}
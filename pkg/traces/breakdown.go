@@ -0,0 +1,312 @@
+package traces
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Breakdown explains where the time of a trace went. Durations are in milliseconds.
+type Breakdown struct {
+	TraceID    string  `json:"traceId"`
+	DurationMs float64 `json:"durationMs"`
+	// The average number of spans working at the same time, i.e. the sum of the self times divided by the duration.
+	Parallelism float64 `json:"parallelism"`
+	// The critical path of the longest root span, in chronological order.
+	CriticalPath []CriticalPathStep `json:"criticalPath"`
+	// Self time of each service and operation, sorted by the time on the critical path.
+	Services   []TimeShare `json:"services"`
+	Operations []TimeShare `json:"operations"`
+	// Time ranges within spans which are not covered by any child span, i.e. time the span worked itself or waited without instrumentation.
+	Gaps        []Gap    `json:"gaps"`
+	Explanation string   `json:"explanation"`
+	Omitted     []string `json:"omitted,omitempty"`
+}
+
+type CriticalPathStep struct {
+	Service string `json:"service"`
+	Name    string `json:"name"`
+	// The ID of the first span of the step.
+	SpanID string `json:"spanId"`
+	// The number of consecutive spans with the same service and name.
+	Count      int     `json:"count"`
+	DurationMs float64 `json:"durationMs"`
+	Percent    float64 `json:"percent"`
+}
+
+type TimeShare struct {
+	Service string `json:"service"`
+	// Empty for the self time of a service.
+	Operation string `json:"operation,omitempty"`
+	SpanCount int    `json:"spanCount"`
+	// The duration of the spans minus the time covered by their children.
+	SelfTimeMs float64 `json:"selfTimeMs"`
+	// The time on the critical path, and its share of the duration of the trace.
+	CriticalPathMs      float64 `json:"criticalPathMs"`
+	CriticalPathPercent float64 `json:"criticalPathPercent"`
+}
+
+type Gap struct {
+	Service string `json:"service"`
+	Name    string `json:"name"`
+	SpanID  string `json:"spanId"`
+	// The start of the gap relative to the start of the trace.
+	OffsetMs       float64 `json:"offsetMs"`
+	DurationMs     float64 `json:"durationMs"`
+	OnCriticalPath bool    `json:"onCriticalPath"`
+}
+
+type interval struct {
+	start time.Time
+	end   time.Time
+}
+
+// Breakdown computes the critical path, the self time per service and operation, and the gaps of a trace.
+// maxItems limits the number of critical path steps, operations and gaps.
+func (t *Trace) Breakdown(maxItems int) *Breakdown {
+	duration := t.Duration()
+	b := &Breakdown{
+		TraceID:    t.TraceID,
+		DurationMs: ms(duration),
+	}
+	percent := func(d time.Duration) float64 {
+		if duration <= 0 {
+			return 0
+		}
+		return float64(int(1000*float64(d)/float64(duration))) / 10
+	}
+
+	segments := t.CriticalPath()
+	critical := map[*Span][]interval{}
+	for _, segment := range segments {
+		critical[segment.Span] = append(critical[segment.Span], interval{segment.Start, segment.End})
+	}
+
+	for _, step := range Steps(Contributions(segments)) {
+		b.CriticalPath = append(b.CriticalPath, CriticalPathStep{
+			Service:    step.Span.Service,
+			Name:       step.Span.Name,
+			SpanID:     step.Span.SpanID,
+			Count:      step.Count,
+			DurationMs: ms(step.Duration),
+			Percent:    percent(step.Duration),
+		})
+	}
+
+	type key struct{ service, operation string }
+	services := map[key]*TimeShare{}
+	operations := map[key]*TimeShare{}
+	share := func(shares map[key]*TimeShare, k key) *TimeShare {
+		if _, ok := shares[k]; !ok {
+			shares[k] = &TimeShare{Service: k.service, Operation: k.operation}
+		}
+		return shares[k]
+	}
+
+	var total time.Duration
+	for _, span := range t.Spans {
+		gaps := uncovered(span)
+		var self, onPath time.Duration
+		for _, gap := range gaps {
+			self += gap.end.Sub(gap.start)
+		}
+		total += self
+		for _, segment := range critical[span] {
+			onPath += segment.end.Sub(segment.start)
+		}
+
+		for _, s := range []*TimeShare{share(services, key{span.Service, ""}), share(operations, key{span.Service, span.Name})} {
+			s.SpanCount++
+			s.SelfTimeMs += ms(self)
+			s.CriticalPathMs += ms(onPath)
+		}
+
+		if len(span.Children) == 0 {
+			continue
+		}
+		for _, gap := range gaps {
+			b.Gaps = append(b.Gaps, Gap{
+				Service:        span.Service,
+				Name:           span.Name,
+				SpanID:         span.SpanID,
+				OffsetMs:       ms(gap.start.Sub(t.Start())),
+				DurationMs:     ms(gap.end.Sub(gap.start)),
+				OnCriticalPath: overlaps(gap, critical[span]),
+			})
+		}
+	}
+	if duration > 0 {
+		b.Parallelism = float64(int(100*float64(total)/float64(duration))) / 100
+	}
+
+	sortShares := func(shares map[key]*TimeShare) []TimeShare {
+		var sorted []TimeShare
+		for _, s := range shares {
+			s.SelfTimeMs = round(s.SelfTimeMs)
+			s.CriticalPathMs = round(s.CriticalPathMs)
+			s.CriticalPathPercent = percent(time.Duration(s.CriticalPathMs * float64(time.Millisecond)))
+			sorted = append(sorted, *s)
+		}
+		slices.SortFunc(sorted, func(a, b TimeShare) int {
+			return cmp.Or(cmp.Compare(b.CriticalPathMs, a.CriticalPathMs), cmp.Compare(b.SelfTimeMs, a.SelfTimeMs),
+				cmp.Compare(a.Service, b.Service), cmp.Compare(a.Operation, b.Operation))
+		})
+		return sorted
+	}
+	b.Services = sortShares(services)
+	b.Operations = sortShares(operations)
+	slices.SortStableFunc(b.Gaps, func(a, b Gap) int { return cmp.Compare(b.DurationMs, a.DurationMs) })
+
+	b.Explanation = b.explain()
+
+	limit := func(name string, n int) int {
+		if n > maxItems {
+			b.Omitted = append(b.Omitted, fmt.Sprintf("%d of %d %s", n-maxItems, n, name))
+			return maxItems
+		}
+		return n
+	}
+	b.CriticalPath = b.CriticalPath[:limit("critical path steps", len(b.CriticalPath))]
+	b.Operations = b.Operations[:limit("operations", len(b.Operations))]
+	b.Gaps = b.Gaps[:limit("gaps", len(b.Gaps))]
+	return b
+}
+
+// uncovered returns the time ranges of a span which are not covered by its children, in chronological order.
+func uncovered(span *Span) []interval {
+	children := slices.Clone(span.Children)
+	slices.SortFunc(children, func(a, b *Span) int { return a.Start.Compare(b.Start) })
+
+	var gaps []interval
+	cursor := span.Start
+	for _, child := range children {
+		start := child.Start
+		if start.Before(span.Start) {
+			start = span.Start
+		}
+		end := child.End
+		if end.After(span.End) {
+			end = span.End
+		}
+		if start.After(cursor) {
+			gaps = append(gaps, interval{cursor, start})
+		}
+		if end.After(cursor) {
+			cursor = end
+		}
+	}
+	if span.End.After(cursor) {
+		gaps = append(gaps, interval{cursor, span.End})
+	}
+	return gaps
+}
+
+func overlaps(gap interval, intervals []interval) bool {
+	for _, i := range intervals {
+		if i.start.Before(gap.end) && gap.start.Before(i.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// explain returns a short explanation of the breakdown.
+func (b *Breakdown) explain() string {
+	var sentences []string
+	sentences = append(sentences, fmt.Sprintf("The trace took %sms.", formatMs(b.DurationMs)))
+
+	var parts []string
+	for _, s := range b.Services[:min(3, len(b.Services))] {
+		if s.CriticalPathMs > 0 {
+			parts = append(parts, fmt.Sprintf("%s %sms (%s%%)", s.Service, formatMs(s.CriticalPathMs), formatMs(s.CriticalPathPercent)))
+		}
+	}
+	if len(parts) > 0 {
+		sentences = append(sentences, "Most of the critical path was spent in "+strings.Join(parts, ", ")+".")
+	}
+
+	if len(b.Operations) > 0 && b.Operations[0].CriticalPathMs > 0 {
+		op := b.Operations[0]
+		sentences = append(sentences, fmt.Sprintf("The slowest operation on the critical path is %s: %s with %sms in %d spans.",
+			op.Service, op.Operation, formatMs(op.CriticalPathMs), op.SpanCount))
+	}
+
+	for _, step := range b.CriticalPath {
+		if step.Count > 1 {
+			sentences = append(sentences, fmt.Sprintf("%d sequential %s: %s spans take %sms of the critical path, consider batching or parallelizing them.",
+				step.Count, step.Service, step.Name, formatMs(step.DurationMs)))
+			break
+		}
+	}
+
+	for _, gap := range b.Gaps {
+		if gap.OnCriticalPath {
+			sentences = append(sentences, fmt.Sprintf("The largest gap on the critical path is %sms in %s: %s, time not covered by any child span (work in the span itself or missing instrumentation).",
+				formatMs(gap.DurationMs), gap.Service, gap.Name))
+			break
+		}
+	}
+
+	if b.Parallelism < 1.2 {
+		sentences = append(sentences, fmt.Sprintf("The spans run mostly sequentially (%.2f spans working on average).", b.Parallelism))
+	} else {
+		sentences = append(sentences, fmt.Sprintf("On average %.2f spans are working at the same time.", b.Parallelism))
+	}
+	return strings.Join(sentences, " ")
+}
+
+// Text renders the breakdown as compact text.
+func (b *Breakdown) Text() string {
+	var sb strings.Builder
+	sb.WriteString(b.Explanation)
+	sb.WriteString("\n\nCritical path (service: operation time share):\n")
+	for _, step := range b.CriticalPath {
+		fmt.Fprintf(&sb, "- %s: %s %sms %s%%", step.Service, step.Name, formatMs(step.DurationMs), formatMs(step.Percent))
+		if step.Count > 1 {
+			fmt.Fprintf(&sb, " (%d spans)", step.Count)
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("\nSelf time by service (critical path, total self time):\n")
+	for _, s := range b.Services {
+		fmt.Fprintf(&sb, "- %s: %sms %s%%, %sms in %d spans\n", s.Service, formatMs(s.CriticalPathMs), formatMs(s.CriticalPathPercent), formatMs(s.SelfTimeMs), s.SpanCount)
+	}
+
+	sb.WriteString("\nSelf time by operation (critical path, total self time):\n")
+	for _, s := range b.Operations {
+		fmt.Fprintf(&sb, "- %s: %s %sms %s%%, %sms in %d spans\n", s.Service, s.Operation, formatMs(s.CriticalPathMs), formatMs(s.CriticalPathPercent), formatMs(s.SelfTimeMs), s.SpanCount)
+	}
+
+	if len(b.Gaps) > 0 {
+		sb.WriteString("\nLargest gaps (time in a span not covered by child spans):\n")
+		for _, gap := range b.Gaps {
+			fmt.Fprintf(&sb, "- %s: %s (span %s) %sms at +%sms", gap.Service, gap.Name, gap.SpanID, formatMs(gap.DurationMs), formatMs(gap.OffsetMs))
+			if gap.OnCriticalPath {
+				sb.WriteString(", on the critical path")
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	if len(b.Omitted) > 0 {
+		fmt.Fprintf(&sb, "\nOmitted: %s\n", strings.Join(b.Omitted, ", "))
+	}
+	return sb.String()
+}
+
+// ms converts a duration to milliseconds, rounded to microseconds.
+func ms(d time.Duration) float64 {
+	return round(float64(d) / float64(time.Millisecond))
+}
+
+func round(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
+
+func formatMs(f float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.3f", f), "0"), ".")
+}
@@ -0,0 +1,42 @@
+package traces
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreakdown(t *testing.T) {
+	trace := testTrace(t, checkoutSpans...)
+
+	b := trace.Breakdown(3)
+	require.Equal(t, 100.0, b.DurationMs)
+	require.Equal(t, 1.0, b.Parallelism)
+	require.Equal(t, []CriticalPathStep{
+		{Service: "frontend", Name: "GET /checkout", SpanID: spanID(1), Count: 1, DurationMs: 30, Percent: 30},
+		{Service: "checkout", Name: "process", SpanID: spanID(2), Count: 1, DurationMs: 20, Percent: 20},
+		{Service: "db", Name: "query", SpanID: spanID(3), Count: 3, DurationMs: 30, Percent: 30},
+	}, b.CriticalPath)
+	require.Equal(t, []TimeShare{
+		{Service: "frontend", SpanCount: 2, SelfTimeMs: 50, CriticalPathMs: 50, CriticalPathPercent: 50},
+		{Service: "db", SpanCount: 3, SelfTimeMs: 30, CriticalPathMs: 30, CriticalPathPercent: 30},
+		{Service: "checkout", SpanCount: 1, SelfTimeMs: 20, CriticalPathMs: 20, CriticalPathPercent: 20},
+	}, b.Services)
+	require.Equal(t, []TimeShare{
+		{Service: "db", Operation: "query", SpanCount: 3, SelfTimeMs: 30, CriticalPathMs: 30, CriticalPathPercent: 30},
+		{Service: "frontend", Operation: "GET /checkout", SpanCount: 1, SelfTimeMs: 30, CriticalPathMs: 30, CriticalPathPercent: 30},
+		{Service: "checkout", Operation: "process", SpanCount: 1, SelfTimeMs: 20, CriticalPathMs: 20, CriticalPathPercent: 20},
+	}, b.Operations)
+	require.Equal(t, []Gap{
+		{Service: "frontend", Name: "GET /checkout", SpanID: spanID(1), OffsetMs: 0, DurationMs: 10, OnCriticalPath: true},
+		{Service: "frontend", Name: "GET /checkout", SpanID: spanID(1), OffsetMs: 60, DurationMs: 10, OnCriticalPath: true},
+		{Service: "frontend", Name: "GET /checkout", SpanID: spanID(1), OffsetMs: 90, DurationMs: 10, OnCriticalPath: true},
+	}, b.Gaps)
+	require.Equal(t, []string{"1 of 4 critical path steps", "1 of 4 operations", "4 of 7 gaps"}, b.Omitted)
+	require.Equal(t, "The trace took 100ms. "+
+		"Most of the critical path was spent in frontend 50ms (50%), db 30ms (30%), checkout 20ms (20%). "+
+		"The slowest operation on the critical path is db: query with 30ms in 3 spans. "+
+		"3 sequential db: query spans take 30ms of the critical path, consider batching or parallelizing them. "+
+		"The largest gap on the critical path is 10ms in frontend: GET /checkout, time not covered by any child span (work in the span itself or missing instrumentation). "+
+		"The spans run mostly sequentially (1.00 spans working on average).", b.Explanation)
+}
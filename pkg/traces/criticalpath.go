@@ -0,0 +1,117 @@
+package traces
+
+import (
+	"slices"
+	"time"
+)
+
+// Segment is a time range in which a span is on the critical path, i.e. the span itself and none of its children was working.
+type Segment struct {
+	Span  *Span
+	Start time.Time
+	End   time.Time
+}
+
+func (s Segment) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// CriticalPath returns the critical path of the longest root span, in chronological order.
+// The critical path is the chain of spans which determines the duration of the root span:
+// starting at the end of a span, the child which finished last is followed, then the child which finished last before that child started, and so on.
+// Children which end after their parent are truncated to the end of the parent.
+func (t *Trace) CriticalPath() []Segment {
+	var root *Span
+	for _, span := range t.Roots {
+		if root == nil || span.Duration() > root.Duration() {
+			root = span
+		}
+	}
+	if root == nil {
+		return nil
+	}
+
+	segments := criticalPath(root, root.End)
+	slices.Reverse(segments)
+	return segments
+}
+
+// criticalPath returns the critical path of a span up to the time until, in reverse chronological order.
+func criticalPath(span *Span, until time.Time) []Segment {
+	cursor := until
+	if span.End.Before(cursor) {
+		cursor = span.End
+	}
+
+	children := slices.Clone(span.Children)
+	slices.SortStableFunc(children, func(a, b *Span) int { return b.End.Compare(a.End) })
+
+	var segments []Segment
+	for _, child := range children {
+		if !child.Start.Before(cursor) || !child.End.After(span.Start) {
+			continue
+		}
+		childEnd := child.End
+		if childEnd.After(cursor) {
+			childEnd = cursor
+		}
+		if childEnd.Before(cursor) {
+			segments = append(segments, Segment{Span: span, Start: childEnd, End: cursor})
+		}
+		segments = append(segments, criticalPath(child, childEnd)...)
+		cursor = child.Start
+		if !cursor.After(span.Start) {
+			return segments
+		}
+	}
+	if cursor.After(span.Start) {
+		segments = append(segments, Segment{Span: span, Start: span.Start, End: cursor})
+	}
+	return segments
+}
+
+// Contribution is the time a span contributes to the critical path.
+type Contribution struct {
+	Span     *Span
+	Duration time.Duration
+}
+
+// Contributions sums the segments of each span, in the order of the first segment of the span.
+func Contributions(segments []Segment) []Contribution {
+	var contributions []Contribution
+	index := map[*Span]int{}
+	for _, segment := range segments {
+		i, ok := index[segment.Span]
+		if !ok {
+			i = len(contributions)
+			index[segment.Span] = i
+			contributions = append(contributions, Contribution{Span: segment.Span})
+		}
+		contributions[i].Duration += segment.Duration()
+	}
+	return contributions
+}
+
+// Step is a span on the critical path, or consecutive spans with the same service and name, e.g. sequential database queries.
+type Step struct {
+	// The first span of the step.
+	Span  *Span
+	Count int
+	// The time the spans contribute to the critical path.
+	Duration time.Duration
+}
+
+// Steps merges the contributions of consecutive spans with the same service and name.
+func Steps(contributions []Contribution) []Step {
+	var steps []Step
+	for _, contribution := range contributions {
+		span := contribution.Span
+		if n := len(steps); n > 0 && steps[n-1].Span.Service == span.Service && steps[n-1].Span.Name == span.Name {
+			steps[n-1].Count++
+			steps[n-1].Duration += contribution.Duration
+			continue
+		}
+		steps = append(steps, Step{Span: span, Count: 1, Duration: contribution.Duration})
+	}
+	return steps
+}
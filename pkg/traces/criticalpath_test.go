@@ -0,0 +1,68 @@
+package traces
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCriticalPath(t *testing.T) {
+	trace := testTrace(t, checkoutSpans...)
+
+	type segment struct {
+		spanID     string
+		start, end int
+	}
+	var segments []segment
+	for _, s := range trace.CriticalPath() {
+		segments = append(segments, segment{s.Span.SpanID, int(s.Start.Sub(testStart).Milliseconds()), int(s.End.Sub(testStart).Milliseconds())})
+	}
+	require.Equal(t, []segment{
+		{spanID(1), 0, 10},
+		{spanID(2), 10, 15},
+		{spanID(3), 15, 25},
+		{spanID(2), 25, 30},
+		{spanID(4), 30, 40},
+		{spanID(2), 40, 45},
+		{spanID(5), 45, 55},
+		{spanID(2), 55, 60},
+		{spanID(1), 60, 70},
+		{spanID(6), 70, 90},
+		{spanID(1), 90, 100},
+	}, segments)
+
+	type step struct {
+		name     string
+		count    int
+		duration time.Duration
+	}
+	var steps []step
+	for _, s := range Steps(Contributions(trace.CriticalPath())) {
+		steps = append(steps, step{s.Span.Name, s.Count, s.Duration})
+	}
+	require.Equal(t, []step{
+		{"GET /checkout", 1, 30 * time.Millisecond},
+		{"process", 1, 20 * time.Millisecond},
+		{"query", 3, 30 * time.Millisecond},
+		{"render", 1, 20 * time.Millisecond},
+	}, steps)
+}
+
+func TestCriticalPathOverlappingChildren(t *testing.T) {
+	// The child which finished last is followed, and children are truncated to the end of their parent
+	trace := testTrace(t,
+		testSpan{id: 1, service: "a", name: "root", start: 0, end: 50},
+		testSpan{id: 2, parent: 1, service: "b", name: "slow", start: 5, end: 60},
+		testSpan{id: 3, parent: 1, service: "c", name: "fast", start: 10, end: 20},
+	)
+
+	var path []string
+	var total time.Duration
+	for _, s := range trace.CriticalPath() {
+		path = append(path, s.Span.Name)
+		total += s.Duration()
+	}
+	require.Equal(t, []string{"root", "slow"}, path)
+	require.Equal(t, 50*time.Millisecond, total)
+}
@@ -0,0 +1,405 @@
+package traces
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Diff describes the differences between a baseline trace and a compared trace. Durations are in milliseconds.
+type Diff struct {
+	Baseline TraceInfo `json:"baseline"`
+	Compared TraceInfo `json:"compared"`
+	// Duration of the compared trace minus the duration of the baseline trace.
+	DurationDeltaMs float64 `json:"durationDeltaMs"`
+	// Operations whose number of spans differs, including added and removed operations.
+	Structure []CountChange `json:"structure"`
+	// Duration changes per service and per operation, sorted by the absolute change of the self time.
+	Services   []DurationChange `json:"services"`
+	Operations []DurationChange `json:"operations"`
+	// Attribute and status differences of matching spans.
+	Attributes  []AttributeChange `json:"attributes"`
+	Explanation string            `json:"explanation"`
+	Omitted     []string          `json:"omitted,omitempty"`
+}
+
+type TraceInfo struct {
+	TraceID    string  `json:"traceId"`
+	DurationMs float64 `json:"durationMs"`
+	SpanCount  int     `json:"spanCount"`
+	ErrorCount int     `json:"errorCount"`
+}
+
+type CountChange struct {
+	Service   string `json:"service"`
+	Operation string `json:"operation"`
+	Baseline  int    `json:"baseline"`
+	Compared  int    `json:"compared"`
+	// added, removed or changed.
+	Change string `json:"change"`
+}
+
+type DurationChange struct {
+	Service string `json:"service"`
+	// Empty for the changes of a service.
+	Operation string `json:"operation,omitempty"`
+	// The sum of the self time of the spans, and the time on the critical path.
+	BaselineSelfTimeMs     float64 `json:"baselineSelfTimeMs"`
+	ComparedSelfTimeMs     float64 `json:"comparedSelfTimeMs"`
+	SelfTimeDeltaMs        float64 `json:"selfTimeDeltaMs"`
+	BaselineCriticalPathMs float64 `json:"baselineCriticalPathMs"`
+	ComparedCriticalPathMs float64 `json:"comparedCriticalPathMs"`
+	CriticalPathDeltaMs    float64 `json:"criticalPathDeltaMs"`
+	// The maximum duration of a single span of the operation.
+	BaselineMaxDurationMs float64 `json:"baselineMaxDurationMs,omitempty"`
+	ComparedMaxDurationMs float64 `json:"comparedMaxDurationMs,omitempty"`
+}
+
+// AttributeChange is a difference of an attribute between matching spans. Spans are matched by their service, operation and ancestors.
+type AttributeChange struct {
+	Service   string `json:"service"`
+	Operation string `json:"operation"`
+	// The attribute key, or status for the span status.
+	Key string `json:"key"`
+	// Empty if the attribute is missing.
+	Baseline string `json:"baseline"`
+	Compared string `json:"compared"`
+	// The number of matching spans with this difference.
+	Spans int `json:"spans"`
+}
+
+type operationKey struct {
+	service   string
+	operation string
+}
+
+type operationStats struct {
+	count        int
+	self         time.Duration
+	criticalPath time.Duration
+	maxDuration  time.Duration
+}
+
+// Compare returns the differences between the baseline trace and the compared trace.
+// maxItems limits the number of structure, operation and attribute changes.
+func Compare(baseline *Trace, compared *Trace, maxItems int) *Diff {
+	d := &Diff{
+		Baseline: baseline.info(),
+		Compared: compared.info(),
+	}
+	d.DurationDeltaMs = round(d.Compared.DurationMs - d.Baseline.DurationMs)
+
+	baselineOps, baselineServices := baseline.operationStats()
+	comparedOps, comparedServices := compared.operationStats()
+
+	for _, key := range sortedKeys(baselineOps, comparedOps) {
+		a, b := baselineOps[key], comparedOps[key]
+		if a.count == b.count {
+			continue
+		}
+		change := CountChange{Service: key.service, Operation: key.operation, Baseline: a.count, Compared: b.count, Change: "changed"}
+		switch {
+		case a.count == 0:
+			change.Change = "added"
+		case b.count == 0:
+			change.Change = "removed"
+		}
+		d.Structure = append(d.Structure, change)
+	}
+	slices.SortStableFunc(d.Structure, func(a, b CountChange) int {
+		return cmp.Compare(abs(b.Compared-b.Baseline), abs(a.Compared-a.Baseline))
+	})
+
+	d.Services = durationChanges(baselineServices, comparedServices)
+	d.Operations = durationChanges(baselineOps, comparedOps)
+	d.Attributes = attributeChanges(baseline, compared)
+	d.Explanation = d.explain()
+
+	limit := func(name string, n int) int {
+		if n > maxItems {
+			d.Omitted = append(d.Omitted, fmt.Sprintf("%d of %d %s", n-maxItems, n, name))
+			return maxItems
+		}
+		return n
+	}
+	d.Structure = d.Structure[:limit("structure changes", len(d.Structure))]
+	d.Operations = d.Operations[:limit("operation changes", len(d.Operations))]
+	d.Attributes = d.Attributes[:limit("attribute changes", len(d.Attributes))]
+	return d
+}
+
+func (t *Trace) info() TraceInfo {
+	info := TraceInfo{TraceID: t.TraceID, DurationMs: ms(t.Duration()), SpanCount: len(t.Spans)}
+	for _, span := range t.Spans {
+		if span.Error {
+			info.ErrorCount++
+		}
+	}
+	return info
+}
+
+// operationStats returns the statistics per operation and per service (with an empty operation).
+func (t *Trace) operationStats() (map[operationKey]operationStats, map[operationKey]operationStats) {
+	criticalPath := map[*Span]time.Duration{}
+	for _, segment := range t.CriticalPath() {
+		criticalPath[segment.Span] += segment.Duration()
+	}
+
+	operations := map[operationKey]operationStats{}
+	services := map[operationKey]operationStats{}
+	for _, span := range t.Spans {
+		var self time.Duration
+		for _, gap := range uncovered(span) {
+			self += gap.end.Sub(gap.start)
+		}
+		for _, k := range []struct {
+			stats map[operationKey]operationStats
+			key   operationKey
+		}{
+			{operations, operationKey{span.Service, span.Name}},
+			{services, operationKey{span.Service, ""}},
+		} {
+			stats := k.stats[k.key]
+			stats.count++
+			stats.self += self
+			stats.criticalPath += criticalPath[span]
+			stats.maxDuration = max(stats.maxDuration, span.Duration())
+			k.stats[k.key] = stats
+		}
+	}
+	return operations, services
+}
+
+func durationChanges(baseline map[operationKey]operationStats, compared map[operationKey]operationStats) []DurationChange {
+	var changes []DurationChange
+	for _, key := range sortedKeys(baseline, compared) {
+		a, b := baseline[key], compared[key]
+		change := DurationChange{
+			Service:                key.service,
+			Operation:              key.operation,
+			BaselineSelfTimeMs:     ms(a.self),
+			ComparedSelfTimeMs:     ms(b.self),
+			SelfTimeDeltaMs:        ms(b.self - a.self),
+			BaselineCriticalPathMs: ms(a.criticalPath),
+			ComparedCriticalPathMs: ms(b.criticalPath),
+			CriticalPathDeltaMs:    ms(b.criticalPath - a.criticalPath),
+		}
+		if key.operation != "" {
+			change.BaselineMaxDurationMs = ms(a.maxDuration)
+			change.ComparedMaxDurationMs = ms(b.maxDuration)
+		}
+		changes = append(changes, change)
+	}
+	slices.SortStableFunc(changes, func(a, b DurationChange) int {
+		return cmp.Or(cmp.Compare(math.Abs(b.SelfTimeDeltaMs), math.Abs(a.SelfTimeDeltaMs)),
+			cmp.Compare(math.Abs(b.CriticalPathDeltaMs), math.Abs(a.CriticalPathDeltaMs)))
+	})
+	return changes
+}
+
+// signature identifies a span by its service, operation and the services and operations of its ancestors.
+func signature(span *Span) string {
+	var parts []string
+	for s := span; s != nil; s = s.Parent {
+		parts = append(parts, s.Service+": "+s.Name)
+	}
+	slices.Reverse(parts)
+	return strings.Join(parts, " > ")
+}
+
+// attributeChanges compares the attributes and the status of matching spans.
+// Spans with the same signature are matched in the order of their start time.
+func attributeChanges(baseline *Trace, compared *Trace) []AttributeChange {
+	bySignature := func(t *Trace) map[string][]*Span {
+		spans := map[string][]*Span{}
+		for _, span := range t.Spans {
+			spans[signature(span)] = append(spans[signature(span)], span)
+		}
+		return spans
+	}
+	baselineSpans := bySignature(baseline)
+	comparedSpans := bySignature(compared)
+
+	type changeKey struct {
+		service, operation, key, baseline, compared string
+	}
+	counts := map[changeKey]int{}
+	for sig, spans := range baselineSpans {
+		others := comparedSpans[sig]
+		for i := range min(len(spans), len(others)) {
+			a, b := spans[i], others[i]
+			for _, key := range slices.Sorted(maps.Keys(mergeKeys(a.Attributes, b.Attributes))) {
+				va, okA := a.Attributes[key]
+				vb, okB := b.Attributes[key]
+				valueA, valueB := "", ""
+				if okA {
+					valueA = shorten(fmt.Sprint(va))
+				}
+				if okB {
+					valueB = shorten(fmt.Sprint(vb))
+				}
+				if valueA != valueB || okA != okB {
+					counts[changeKey{a.Service, a.Name, key, valueA, valueB}]++
+				}
+			}
+			if a.Error != b.Error || a.StatusMessage != b.StatusMessage {
+				counts[changeKey{a.Service, a.Name, "status", status(a), status(b)}]++
+			}
+		}
+	}
+
+	var changes []AttributeChange
+	for k, n := range counts {
+		changes = append(changes, AttributeChange{Service: k.service, Operation: k.operation, Key: k.key, Baseline: k.baseline, Compared: k.compared, Spans: n})
+	}
+	// Status changes first, then the most frequent changes
+	slices.SortFunc(changes, func(a, b AttributeChange) int {
+		return cmp.Or(cmp.Compare(boolInt(b.Key == "status"), boolInt(a.Key == "status")), cmp.Compare(b.Spans, a.Spans),
+			cmp.Compare(a.Service, b.Service), cmp.Compare(a.Operation, b.Operation), cmp.Compare(a.Key, b.Key),
+			cmp.Compare(a.Baseline, b.Baseline), cmp.Compare(a.Compared, b.Compared))
+	})
+	return changes
+}
+
+func status(span *Span) string {
+	s := "ok"
+	if span.Error {
+		s = "error"
+	}
+	if span.StatusMessage != "" {
+		s += ": " + shorten(span.StatusMessage)
+	}
+	return s
+}
+
+// explain returns a short explanation of the diff.
+func (d *Diff) explain() string {
+	var sentences []string
+	sentences = append(sentences, fmt.Sprintf("The compared trace took %sms, the baseline trace %sms (%s).",
+		formatMs(d.Compared.DurationMs), formatMs(d.Baseline.DurationMs), formatDelta(d.DurationDeltaMs, d.Baseline.DurationMs)))
+
+	if len(d.Operations) > 0 && d.Operations[0].SelfTimeDeltaMs != 0 {
+		op := d.Operations[0]
+		sentences = append(sentences, fmt.Sprintf("The largest change is the self time of %s: %s (%sms to %sms, %s on the critical path).",
+			op.Service, op.Operation, formatMs(op.BaselineSelfTimeMs), formatMs(op.ComparedSelfTimeMs), formatDelta(op.CriticalPathDeltaMs, 0)))
+	}
+
+	for _, change := range d.Structure[:min(3, len(d.Structure))] {
+		switch change.Change {
+		case "added":
+			sentences = append(sentences, fmt.Sprintf("%d %s: %s spans were added.", change.Compared, change.Service, change.Operation))
+		case "removed":
+			sentences = append(sentences, fmt.Sprintf("%d %s: %s spans were removed.", change.Baseline, change.Service, change.Operation))
+		default:
+			sentences = append(sentences, fmt.Sprintf("The number of %s: %s spans changed from %d to %d.", change.Service, change.Operation, change.Baseline, change.Compared))
+		}
+	}
+
+	if d.Compared.ErrorCount != d.Baseline.ErrorCount {
+		sentences = append(sentences, fmt.Sprintf("The number of error spans changed from %d to %d.", d.Baseline.ErrorCount, d.Compared.ErrorCount))
+	}
+	if len(d.Structure) == 0 {
+		sentences = append(sentences, "Both traces have the same operations.")
+	}
+	return strings.Join(sentences, " ")
+}
+
+// Text renders the diff as compact text.
+func (d *Diff) Text() string {
+	var sb strings.Builder
+	sb.WriteString(d.Explanation)
+	fmt.Fprintf(&sb, "\n\nBaseline trace %s: %sms, %d spans, %d errors\n", d.Baseline.TraceID, formatMs(d.Baseline.DurationMs), d.Baseline.SpanCount, d.Baseline.ErrorCount)
+	fmt.Fprintf(&sb, "Compared trace %s: %sms, %d spans, %d errors\n", d.Compared.TraceID, formatMs(d.Compared.DurationMs), d.Compared.SpanCount, d.Compared.ErrorCount)
+
+	if len(d.Structure) > 0 {
+		sb.WriteString("\nSpan count changes (baseline -> compared):\n")
+		for _, change := range d.Structure {
+			fmt.Fprintf(&sb, "- %s: %s %d -> %d (%s)\n", change.Service, change.Operation, change.Baseline, change.Compared, change.Change)
+		}
+	}
+
+	writeChanges := func(title string, changes []DurationChange) {
+		sb.WriteString("\n" + title + " (self time baseline -> compared, critical path delta):\n")
+		for _, change := range changes {
+			name := change.Service
+			if change.Operation != "" {
+				name += ": " + change.Operation
+			}
+			fmt.Fprintf(&sb, "- %s %sms -> %sms (%s), critical path %s\n", name,
+				formatMs(change.BaselineSelfTimeMs), formatMs(change.ComparedSelfTimeMs), formatDelta(change.SelfTimeDeltaMs, change.BaselineSelfTimeMs),
+				formatDelta(change.CriticalPathDeltaMs, 0))
+		}
+	}
+	writeChanges("Services", d.Services)
+	writeChanges("Operations", d.Operations)
+
+	if len(d.Attributes) > 0 {
+		sb.WriteString("\nAttribute changes of matching spans (baseline -> compared):\n")
+		for _, change := range d.Attributes {
+			fmt.Fprintf(&sb, "- %s: %s %s: %s -> %s (%d spans)\n", change.Service, change.Operation, change.Key,
+				quoteValue(change.Baseline), quoteValue(change.Compared), change.Spans)
+		}
+	}
+
+	if len(d.Omitted) > 0 {
+		fmt.Fprintf(&sb, "\nOmitted: %s\n", strings.Join(d.Omitted, ", "))
+	}
+	return sb.String()
+}
+
+// formatDelta formats a change in milliseconds, with the relative change if the base is not zero.
+func formatDelta(delta float64, base float64) string {
+	sign := "+"
+	if delta < 0 {
+		sign = "-"
+	}
+	s := sign + formatMs(math.Abs(delta)) + "ms"
+	if base != 0 {
+		s += fmt.Sprintf(", %s%.0f%%", sign, math.Abs(100*delta/base))
+	}
+	return s
+}
+
+func quoteValue(value string) string {
+	if value == "" {
+		return "(missing)"
+	}
+	return fmt.Sprintf("%q", value)
+}
+
+func sortedKeys[V any](a map[operationKey]V, b map[operationKey]V) []operationKey {
+	keys := slices.Collect(maps.Keys(mergeKeys(a, b)))
+	slices.SortFunc(keys, func(x, y operationKey) int {
+		return cmp.Or(cmp.Compare(x.service, y.service), cmp.Compare(x.operation, y.operation))
+	})
+	return keys
+}
+
+func mergeKeys[K comparable, V any](a map[K]V, b map[K]V) map[K]bool {
+	keys := map[K]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	return keys
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
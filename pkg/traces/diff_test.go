@@ -0,0 +1,82 @@
+package traces
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// slowerCheckoutSpans is the checkout request of checkoutSpans with a slower and an additional query, a cache lookup and a successful render step.
+var slowerCheckoutSpans = []testSpan{
+	{id: 1, service: "frontend", name: "GET /checkout", start: 0, end: 130, attributes: map[string]string{"http.method": "POST"}},
+	{id: 2, parent: 1, service: "checkout", name: "process", start: 10, end: 90},
+	{id: 3, parent: 2, service: "db", name: "query", start: 15, end: 25, attributes: map[string]string{"db.table": "carts"}},
+	{id: 4, parent: 2, service: "db", name: "query", start: 30, end: 40, attributes: map[string]string{"db.table": "carts"}},
+	{id: 5, parent: 2, service: "db", name: "query", start: 45, end: 75, attributes: map[string]string{"db.table": "orders"}},
+	{id: 7, parent: 2, service: "db", name: "query", start: 78, end: 88, attributes: map[string]string{"db.table": "payments"}},
+	{id: 8, parent: 1, service: "cache", name: "get", start: 92, end: 95},
+	{id: 6, parent: 1, service: "frontend", name: "render", start: 100, end: 120},
+}
+
+func TestCompare(t *testing.T) {
+	baseline := testTrace(t, checkoutSpans...)
+	compared := testTrace(t, slowerCheckoutSpans...)
+
+	diff := Compare(baseline, compared, 10)
+	require.Equal(t, TraceInfo{TraceID: baseline.TraceID, DurationMs: 100, SpanCount: 6, ErrorCount: 1}, diff.Baseline)
+	require.Equal(t, TraceInfo{TraceID: compared.TraceID, DurationMs: 130, SpanCount: 8, ErrorCount: 0}, diff.Compared)
+	require.Equal(t, 30.0, diff.DurationDeltaMs)
+
+	require.Equal(t, []CountChange{
+		{Service: "cache", Operation: "get", Baseline: 0, Compared: 1, Change: "added"},
+		{Service: "db", Operation: "query", Baseline: 3, Compared: 4, Change: "changed"},
+	}, diff.Structure)
+
+	require.Equal(t, DurationChange{
+		Service:                "db",
+		Operation:              "query",
+		BaselineSelfTimeMs:     30,
+		ComparedSelfTimeMs:     60,
+		SelfTimeDeltaMs:        30,
+		BaselineCriticalPathMs: 30,
+		ComparedCriticalPathMs: 60,
+		CriticalPathDeltaMs:    30,
+		BaselineMaxDurationMs:  10,
+		ComparedMaxDurationMs:  30,
+	}, diff.Operations[0])
+	require.Equal(t, "db", diff.Services[0].Service)
+	require.Empty(t, diff.Services[0].Operation)
+
+	require.Equal(t, []AttributeChange{
+		{Service: "frontend", Operation: "render", Key: "status", Baseline: "error: timeout", Compared: "ok", Spans: 1},
+		{Service: "frontend", Operation: "GET /checkout", Key: "http.method", Baseline: "GET", Compared: "POST", Spans: 1},
+	}, diff.Attributes)
+
+	require.Equal(t, "The compared trace took 130ms, the baseline trace 100ms (+30ms, +30%). "+
+		"The largest change is the self time of db: query (30ms to 60ms, +30ms on the critical path). "+
+		"1 cache: get spans were added. The number of db: query spans changed from 3 to 4. "+
+		"The number of error spans changed from 1 to 0.", diff.Explanation)
+	require.Empty(t, diff.Omitted)
+
+	text := diff.Text()
+	require.Contains(t, text, "\nSpan count changes (baseline -> compared):\n- cache: get 0 -> 1 (added)\n- db: query 3 -> 4 (changed)\n")
+	require.Contains(t, text, "\n- db: query 30ms -> 60ms (+30ms, +100%), critical path +30ms\n")
+	require.Contains(t, text, "\n- frontend: render status: \"error: timeout\" -> \"ok\" (1 spans)\n")
+}
+
+func TestCompareLimits(t *testing.T) {
+	diff := Compare(testTrace(t, checkoutSpans...), testTrace(t, slowerCheckoutSpans...), 1)
+	require.Len(t, diff.Structure, 1)
+	require.Len(t, diff.Operations, 1)
+	require.Len(t, diff.Attributes, 1)
+	require.Equal(t, []string{"1 of 2 structure changes", "4 of 5 operation changes", "1 of 2 attribute changes"}, diff.Omitted)
+}
+
+func TestCompareSameTrace(t *testing.T) {
+	trace := testTrace(t, checkoutSpans...)
+
+	diff := Compare(trace, trace, 10)
+	require.Empty(t, diff.Structure)
+	require.Empty(t, diff.Attributes)
+	require.Equal(t, "The compared trace took 100ms, the baseline trace 100ms (+0ms, +0%). Both traces have the same operations.", diff.Explanation)
+}
@@ -0,0 +1,335 @@
+package traces
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SummaryOptions limit the size of a summary.
+type SummaryOptions struct {
+	// Maximum depth of the span hierarchy. Deeper spans are counted, but not listed.
+	MaxDepth int
+	// Maximum number of lines of the span hierarchy.
+	MaxSpans int
+	// Maximum number of attributes, and of values per attribute.
+	TopAttributes int
+	// Maximum number of error spans.
+	MaxErrors int
+}
+
+// maxValueLength is the maximum length of attribute values and status messages in a summary.
+const maxValueLength = 80
+
+// Summary is a compact description of a trace.
+type Summary struct {
+	TraceID      string           `json:"traceId"`
+	Start        time.Time        `json:"start"`
+	Duration     string           `json:"duration"`
+	SpanCount    int              `json:"spanCount"`
+	ErrorCount   int              `json:"errorCount"`
+	Services     []ServiceSummary `json:"services"`
+	Hierarchy    []HierarchyNode  `json:"hierarchy"`
+	CriticalPath []PathStep       `json:"criticalPath"`
+	Errors       []ErrorSpan      `json:"errors"`
+	Attributes   []AttributeStats `json:"topAttributes"`
+	// Notes about omitted data.
+	Omitted []string `json:"omitted,omitempty"`
+}
+
+type ServiceSummary struct {
+	Name       string   `json:"name"`
+	SpanCount  int      `json:"spanCount"`
+	ErrorCount int      `json:"errorCount"`
+	Operations []string `json:"operations"`
+}
+
+// HierarchyNode is a line of the span hierarchy. Repeated sibling spans with the same service and name are collapsed into one node.
+type HierarchyNode struct {
+	Depth     int    `json:"depth"`
+	Service   string `json:"service"`
+	Name      string `json:"name"`
+	Kind      string `json:"kind,omitempty"`
+	Duration  string `json:"duration"`
+	Count     int    `json:"count,omitempty"`
+	Errors    int    `json:"errors,omitempty"`
+	Collapsed int    `json:"collapsedDescendants,omitempty"`
+}
+
+type PathStep struct {
+	Service string `json:"service"`
+	Name    string `json:"name"`
+	// The ID of the first span, if consecutive spans were merged.
+	SpanID   string `json:"spanId"`
+	Count    int    `json:"count,omitempty"`
+	SelfTime string `json:"selfTime"`
+}
+
+type ErrorSpan struct {
+	Service string `json:"service"`
+	Name    string `json:"name"`
+	SpanID  string `json:"spanId"`
+	Message string `json:"message,omitempty"`
+}
+
+type AttributeStats struct {
+	Key    string       `json:"key"`
+	Spans  int          `json:"spans"`
+	Values []ValueCount `json:"values"`
+}
+
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Summarize returns a summary of the trace.
+func (t *Trace) Summarize(opts SummaryOptions) *Summary {
+	summary := &Summary{
+		TraceID:   t.TraceID,
+		Start:     t.Start().UTC(),
+		Duration:  formatDuration(t.Duration()),
+		SpanCount: len(t.Spans),
+	}
+
+	services := map[string]*ServiceSummary{}
+	for _, span := range t.Spans {
+		service, ok := services[span.Service]
+		if !ok {
+			service = &ServiceSummary{Name: span.Service}
+			services[span.Service] = service
+		}
+		service.SpanCount++
+		if !slices.Contains(service.Operations, span.Name) {
+			service.Operations = append(service.Operations, span.Name)
+		}
+		if span.Error {
+			service.ErrorCount++
+			summary.ErrorCount++
+			if len(summary.Errors) < opts.MaxErrors {
+				summary.Errors = append(summary.Errors, ErrorSpan{
+					Service: span.Service,
+					Name:    span.Name,
+					SpanID:  span.SpanID,
+					Message: shorten(span.StatusMessage),
+				})
+			}
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		summary.Services = append(summary.Services, *services[name])
+	}
+	if summary.ErrorCount > len(summary.Errors) {
+		summary.Omitted = append(summary.Omitted, fmt.Sprintf("%d of %d error spans", summary.ErrorCount-len(summary.Errors), summary.ErrorCount))
+	}
+
+	summary.Hierarchy = appendHierarchy(nil, t.Roots, 0, opts)
+	if len(summary.Hierarchy) >= opts.MaxSpans {
+		summary.Omitted = append(summary.Omitted, fmt.Sprintf("the hierarchy is limited to %d lines", opts.MaxSpans))
+	}
+
+	var steps []PathStep
+	for _, step := range Steps(Contributions(t.CriticalPath())) {
+		pathStep := PathStep{Service: step.Span.Service, Name: step.Span.Name, SpanID: step.Span.SpanID, SelfTime: formatDuration(step.Duration)}
+		if step.Count > 1 {
+			pathStep.Count = step.Count
+		}
+		steps = append(steps, pathStep)
+	}
+	if len(steps) > opts.MaxSpans {
+		summary.Omitted = append(summary.Omitted, fmt.Sprintf("%d of %d steps of the critical path", len(steps)-opts.MaxSpans, len(steps)))
+		steps = steps[:opts.MaxSpans]
+	}
+	summary.CriticalPath = steps
+
+	summary.Attributes = topAttributes(t.Spans, opts.TopAttributes)
+	return summary
+}
+
+// appendHierarchy appends the nodes of sibling spans. Repeated siblings are collapsed, and the children of the longest repeated sibling are listed.
+func appendHierarchy(nodes []HierarchyNode, siblings []*Span, depth int, opts SummaryOptions) []HierarchyNode {
+	type group struct {
+		service string
+		name    string
+	}
+	var order []group
+	groups := map[group][]*Span{}
+	for _, span := range siblings {
+		g := group{span.Service, span.Name}
+		if _, ok := groups[g]; !ok {
+			order = append(order, g)
+		}
+		groups[g] = append(groups[g], span)
+	}
+
+	for _, g := range order {
+		if len(nodes) >= opts.MaxSpans {
+			return nodes
+		}
+
+		spans := groups[g]
+		longest := slices.MaxFunc(spans, func(a, b *Span) int { return cmp.Compare(a.Duration(), b.Duration()) })
+		node := HierarchyNode{
+			Depth:    depth,
+			Service:  g.service,
+			Name:     g.name,
+			Kind:     longest.Kind,
+			Duration: formatDuration(longest.Duration()),
+		}
+		if len(spans) > 1 {
+			node.Count = len(spans)
+			node.Duration = "max " + node.Duration
+		}
+		for _, span := range spans {
+			if span.Error {
+				node.Errors++
+			}
+		}
+
+		if depth+1 >= opts.MaxDepth {
+			for _, span := range spans {
+				node.Collapsed += countDescendants(span)
+			}
+			nodes = append(nodes, node)
+			continue
+		}
+		nodes = append(nodes, node)
+		for _, span := range spans {
+			if span != longest {
+				nodes[len(nodes)-1].Collapsed += countDescendants(span)
+			}
+		}
+		nodes = appendHierarchy(nodes, longest.Children, depth+1, opts)
+	}
+	return nodes
+}
+
+func countDescendants(span *Span) int {
+	n := 0
+	for _, child := range span.Children {
+		n += 1 + countDescendants(child)
+	}
+	return n
+}
+
+// topAttributes returns the attributes present in the most spans, with their most frequent values.
+func topAttributes(spans []*Span, limit int) []AttributeStats {
+	counts := map[string]map[string]int{}
+	spanCounts := map[string]int{}
+	for _, span := range spans {
+		for key, value := range span.Attributes {
+			if counts[key] == nil {
+				counts[key] = map[string]int{}
+			}
+			counts[key][shorten(fmt.Sprint(value))]++
+			spanCounts[key]++
+		}
+	}
+
+	keys := slices.SortedFunc(maps.Keys(counts), func(a, b string) int {
+		return cmp.Or(cmp.Compare(spanCounts[b], spanCounts[a]), cmp.Compare(a, b))
+	})
+	var stats []AttributeStats
+	for _, key := range keys[:min(limit, len(keys))] {
+		values := slices.SortedFunc(maps.Keys(counts[key]), func(a, b string) int {
+			return cmp.Or(cmp.Compare(counts[key][b], counts[key][a]), cmp.Compare(a, b))
+		})
+		attr := AttributeStats{Key: key, Spans: spanCounts[key]}
+		for _, value := range values[:min(limit, len(values))] {
+			attr.Values = append(attr.Values, ValueCount{Value: value, Count: counts[key][value]})
+		}
+		stats = append(stats, attr)
+	}
+	return stats
+}
+
+// Text renders the summary as compact text.
+func (s *Summary) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Trace %s: %d spans, %d services, %d errors, duration %s, started %s\n",
+		s.TraceID, s.SpanCount, len(s.Services), s.ErrorCount, s.Duration, s.Start.Format(time.RFC3339))
+
+	b.WriteString("\nServices:\n")
+	for _, service := range s.Services {
+		fmt.Fprintf(&b, "- %s: %d spans, %d errors, operations: %s\n",
+			service.Name, service.SpanCount, service.ErrorCount, strings.Join(service.Operations, ", "))
+	}
+
+	b.WriteString("\nHierarchy (service: operation duration):\n")
+	for _, node := range s.Hierarchy {
+		fmt.Fprintf(&b, "%s- %s: %s %s", strings.Repeat("  ", node.Depth), node.Service, node.Name, node.Duration)
+		if node.Count > 1 {
+			fmt.Fprintf(&b, " x%d", node.Count)
+		}
+		if node.Errors > 0 {
+			fmt.Fprintf(&b, " [%d errors]", node.Errors)
+		}
+		if node.Collapsed > 0 {
+			fmt.Fprintf(&b, " (+%d spans)", node.Collapsed)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\nCritical path (service: operation self time):\n")
+	for _, step := range s.CriticalPath {
+		fmt.Fprintf(&b, "- %s: %s %s", step.Service, step.Name, step.SelfTime)
+		if step.Count > 1 {
+			fmt.Fprintf(&b, " (%d spans)", step.Count)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(s.Errors) > 0 {
+		b.WriteString("\nError spans:\n")
+		for _, span := range s.Errors {
+			fmt.Fprintf(&b, "- %s: %s (span %s)", span.Service, span.Name, span.SpanID)
+			if span.Message != "" {
+				fmt.Fprintf(&b, ": %s", span.Message)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if len(s.Attributes) > 0 {
+		b.WriteString("\nTop attributes (value count):\n")
+		for _, attr := range s.Attributes {
+			values := make([]string, 0, len(attr.Values))
+			for _, value := range attr.Values {
+				values = append(values, fmt.Sprintf("%s (%d)", value.Value, value.Count))
+			}
+			fmt.Fprintf(&b, "- %s in %d spans: %s\n", attr.Key, attr.Spans, strings.Join(values, ", "))
+		}
+	}
+
+	if len(s.Omitted) > 0 {
+		fmt.Fprintf(&b, "\nOmitted: %s\n", strings.Join(s.Omitted, ", "))
+	}
+	return b.String()
+}
+
+func shorten(s string) string {
+	if len(s) <= maxValueLength {
+		return s
+	}
+	for i := range s {
+		if i >= maxValueLength {
+			return s[:i] + "..."
+		}
+	}
+	return s
+}
+
+// formatDuration rounds a duration to microseconds, or to milliseconds if it is longer than a second.
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(time.Microsecond).String()
+	default:
+		return d.String()
+	}
+}
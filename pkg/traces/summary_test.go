@@ -0,0 +1,57 @@
+package traces
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarize(t *testing.T) {
+	trace := testTrace(t, checkoutSpans...)
+
+	summary := trace.Summarize(SummaryOptions{MaxDepth: 10, MaxSpans: 20, TopAttributes: 5, MaxErrors: 5})
+	require.Equal(t, `Trace 0102030405060708090a0b0c0d0e0f10: 6 spans, 3 services, 1 errors, duration 100ms, started 2026-10-01T12:00:00Z
+
+Services:
+- checkout: 1 spans, 0 errors, operations: process
+- db: 3 spans, 0 errors, operations: query
+- frontend: 2 spans, 1 errors, operations: GET /checkout, render
+
+Hierarchy (service: operation duration):
+- frontend: GET /checkout 100ms
+  - checkout: process 50ms
+    - db: query max 10ms x3
+  - frontend: render 20ms [1 errors]
+
+Critical path (service: operation self time):
+- frontend: GET /checkout 30ms
+- checkout: process 20ms
+- db: query 30ms (3 spans)
+- frontend: render 20ms
+
+Error spans:
+- frontend: render (span 0000000000000006): timeout
+
+Top attributes (value count):
+- db.table in 3 spans: carts (2), orders (1)
+- http.method in 1 spans: GET (1)
+`, summary.Text())
+}
+
+func TestSummarizeLimits(t *testing.T) {
+	trace := testTrace(t, checkoutSpans...)
+
+	summary := trace.Summarize(SummaryOptions{MaxDepth: 2, MaxSpans: 2, TopAttributes: 1, MaxErrors: 0})
+	require.Equal(t, []HierarchyNode{
+		{Depth: 0, Service: "frontend", Name: "GET /checkout", Kind: "server", Duration: "100ms"},
+		{Depth: 1, Service: "checkout", Name: "process", Kind: "server", Duration: "50ms", Collapsed: 3},
+	}, summary.Hierarchy)
+	require.Len(t, summary.CriticalPath, 2)
+	require.Empty(t, summary.Errors)
+	require.Equal(t, []AttributeStats{{Key: "db.table", Spans: 3, Values: []ValueCount{{Value: "carts", Count: 2}}}}, summary.Attributes)
+	require.Equal(t, []string{
+		"1 of 1 error spans",
+		"the hierarchy is limited to 2 lines",
+		"2 of 4 steps of the critical path",
+	}, summary.Omitted)
+}
@@ -0,0 +1,311 @@
+package traces
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Trace is a parsed trace with its span hierarchy.
+type Trace struct {
+	TraceID string
+	// All spans, sorted by start time.
+	Spans []*Span
+	// Spans without a parent in the trace, sorted by start time. Spans of an incomplete trace may have a parent which is missing.
+	// A span of a parent cycle (e.g. A is the parent of B and B is the parent of A) is a root as well.
+	Roots []*Span
+}
+
+type Span struct {
+	SpanID        string
+	ParentSpanID  string
+	Name          string
+	Service       string
+	Kind          string
+	Start         time.Time
+	End           time.Time
+	Error         bool
+	StatusMessage string
+	// Span attributes. Resource attributes except service.name are not kept.
+	Attributes map[string]any
+
+	Parent *Span
+	// Child spans, sorted by start time.
+	Children []*Span
+}
+
+func (s *Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Start returns the start time of the earliest span.
+func (t *Trace) Start() time.Time {
+	if len(t.Spans) == 0 {
+		return time.Time{}
+	}
+	return t.Spans[0].Start
+}
+
+// Duration returns the time between the start of the earliest span and the end of the latest span.
+func (t *Trace) Duration() time.Duration {
+	var end time.Time
+	for _, span := range t.Spans {
+		if span.End.After(end) {
+			end = span.End
+		}
+	}
+	return end.Sub(t.Start())
+}
+
+// otlp is the OTLP JSON format of a trace, as returned by the Tempo HTTP API.
+// /api/traces/<id> returns the batches field, /api/v2/traces/<id> returns the trace field.
+type otlp struct {
+	Batches       []resourceSpans `json:"batches"`
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+	Trace         *struct {
+		ResourceSpans []resourceSpans `json:"resourceSpans"`
+	} `json:"trace"`
+}
+
+type resourceSpans struct {
+	Resource struct {
+		Attributes []keyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans                  []scopeSpans `json:"scopeSpans"`
+	InstrumentationLibrarySpans []scopeSpans `json:"instrumentationLibrarySpans"`
+}
+
+type scopeSpans struct {
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId"`
+	Name              string          `json:"name"`
+	Kind              json.RawMessage `json:"kind"`
+	StartTimeUnixNano json.RawMessage `json:"startTimeUnixNano"`
+	EndTimeUnixNano   json.RawMessage `json:"endTimeUnixNano"`
+	Attributes        []keyValue      `json:"attributes"`
+	Status            struct {
+		Code    json.RawMessage `json:"code"`
+		Message string          `json:"message"`
+	} `json:"status"`
+}
+
+type keyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+// Parse parses a trace in the OTLP JSON format.
+func Parse(data []byte) (*Trace, error) {
+	var raw otlp
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse trace: %w", err)
+	}
+
+	batches := slices.Concat(raw.Batches, raw.ResourceSpans)
+	if raw.Trace != nil {
+		batches = append(batches, raw.Trace.ResourceSpans...)
+	}
+
+	trace := &Trace{}
+	for _, batch := range batches {
+		service := ""
+		for _, attr := range batch.Resource.Attributes {
+			if attr.Key == "service.name" {
+				service = fmt.Sprint(attributeValue(attr.Value))
+			}
+		}
+
+		for _, scope := range slices.Concat(batch.ScopeSpans, batch.InstrumentationLibrarySpans) {
+			for _, s := range scope.Spans {
+				span, err := parseSpan(s, service)
+				if err != nil {
+					return nil, err
+				}
+				if trace.TraceID == "" {
+					trace.TraceID = normalizeID(s.TraceID)
+				}
+				trace.Spans = append(trace.Spans, span)
+			}
+		}
+	}
+	if len(trace.Spans) == 0 {
+		return nil, errors.New("the trace has no spans")
+	}
+
+	trace.link()
+	return trace, nil
+}
+
+func parseSpan(s otlpSpan, service string) (*Span, error) {
+	start, err := parseUnixNano(s.StartTimeUnixNano)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start time of span %s: %w", s.SpanID, err)
+	}
+	end, err := parseUnixNano(s.EndTimeUnixNano)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end time of span %s: %w", s.SpanID, err)
+	}
+
+	span := &Span{
+		SpanID:        normalizeID(s.SpanID),
+		ParentSpanID:  normalizeID(s.ParentSpanID),
+		Name:          s.Name,
+		Service:       service,
+		Kind:          parseEnum(s.Kind, "SPAN_KIND_", []string{"unspecified", "internal", "server", "client", "producer", "consumer"}),
+		Start:         start,
+		End:           end,
+		Error:         parseEnum(s.Status.Code, "STATUS_CODE_", []string{"unset", "ok", "error"}) == "error",
+		StatusMessage: s.Status.Message,
+		Attributes:    map[string]any{},
+	}
+	for _, attr := range s.Attributes {
+		span.Attributes[attr.Key] = attributeValue(attr.Value)
+	}
+	return span, nil
+}
+
+// link builds the span hierarchy.
+func (t *Trace) link() {
+	byStart := func(a, b *Span) int { return a.Start.Compare(b.Start) }
+	slices.SortStableFunc(t.Spans, byStart)
+
+	spans := map[string]*Span{}
+	for _, span := range t.Spans {
+		spans[span.SpanID] = span
+	}
+	for _, span := range t.Spans {
+		parent, ok := spans[span.ParentSpanID]
+		if span.ParentSpanID == "" || !ok || parent == span {
+			t.Roots = append(t.Roots, span)
+			continue
+		}
+		span.Parent = parent
+		parent.Children = append(parent.Children, span)
+	}
+
+	if t.breakCycles() {
+		slices.SortStableFunc(t.Roots, byStart)
+	}
+}
+
+// breakCycles turns the earliest span of each parent cycle into a root, which keeps the walks up and down the hierarchy finite.
+// Returns true if a cycle was found.
+func (t *Trace) breakCycles() bool {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[*Span]int{}
+	found := false
+	for _, span := range t.Spans {
+		var path []*Span
+		for s := span; s != nil && state[s] != done; s = s.Parent {
+			if state[s] == visiting {
+				// s is its own ancestor, it becomes the root of the other spans of the cycle
+				s.Parent.Children = slices.DeleteFunc(s.Parent.Children, func(child *Span) bool { return child == s })
+				s.Parent = nil
+				t.Roots = append(t.Roots, s)
+				found = true
+				break
+			}
+			state[s] = visiting
+			path = append(path, s)
+		}
+		for _, s := range path {
+			state[s] = done
+		}
+	}
+	return found
+}
+
+// normalizeID returns the hex encoding of a trace or span ID. Tempo returns IDs in base64 or in hex.
+func normalizeID(id string) string {
+	if id == "" {
+		return ""
+	}
+	if _, err := hex.DecodeString(id); err == nil && (len(id) == 16 || len(id) == 32) {
+		return strings.ToLower(id)
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(id); err == nil {
+		return hex.EncodeToString(decoded)
+	}
+	return id
+}
+
+// parseUnixNano parses a timestamp, which is a string or a number in OTLP JSON.
+func parseUnixNano(raw json.RawMessage) (time.Time, error) {
+	s := strings.Trim(string(raw), `"`)
+	if s == "" || s == "null" {
+		return time.Time{}, nil
+	}
+	nanos, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, nanos), nil
+}
+
+// parseEnum parses an enum, which is a name (e.g. SPAN_KIND_SERVER) or a number in OTLP JSON.
+func parseEnum(raw json.RawMessage, prefix string, values []string) string {
+	s := strings.Trim(string(raw), `"`)
+	if n, err := strconv.Atoi(s); err == nil {
+		if n >= 0 && n < len(values) {
+			return values[n]
+		}
+		return s
+	}
+	if s == "" || s == "null" {
+		return values[0]
+	}
+	return strings.ToLower(strings.TrimPrefix(s, prefix))
+}
+
+// attributeValue converts an OTLP JSON attribute value to a Go value.
+func attributeValue(value map[string]any) any {
+	for typ, v := range value {
+		switch typ {
+		case "intValue":
+			if n, err := strconv.ParseInt(fmt.Sprint(v), 10, 64); err == nil {
+				return n
+			}
+			return v
+		case "arrayValue":
+			var values []any
+			if array, ok := v.(map[string]any); ok {
+				items, _ := array["values"].([]any)
+				for _, item := range items {
+					if itemValue, ok := item.(map[string]any); ok {
+						values = append(values, attributeValue(itemValue))
+					}
+				}
+			}
+			return values
+		case "kvlistValue":
+			kv := map[string]any{}
+			if list, ok := v.(map[string]any); ok {
+				items, _ := list["values"].([]any)
+				for _, item := range items {
+					if entry, ok := item.(map[string]any); ok {
+						entryValue, _ := entry["value"].(map[string]any)
+						kv[fmt.Sprint(entry["key"])] = attributeValue(entryValue)
+					}
+				}
+			}
+			return kv
+		default:
+			return v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package traces
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testStart = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// testSpan is a span of a fixture trace. IDs are numbers, times are milliseconds after testStart.
+type testSpan struct {
+	id         int
+	parent     int
+	service    string
+	name       string
+	start      int
+	end        int
+	error      string
+	attributes map[string]string
+}
+
+func spanID(id int) string {
+	if id == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%016x", id)
+}
+
+// testTrace encodes the spans in the OTLP JSON format of the Tempo API, and parses them.
+func testTrace(t *testing.T, spans ...testSpan) *Trace {
+	t.Helper()
+
+	var batches []any
+	for _, s := range spans {
+		var attributes []any
+		for key, value := range s.attributes {
+			attributes = append(attributes, map[string]any{"key": key, "value": map[string]any{"stringValue": value}})
+		}
+		status := map[string]any{}
+		if s.error != "" {
+			status = map[string]any{"code": "STATUS_CODE_ERROR", "message": s.error}
+		}
+		batches = append(batches, map[string]any{
+			"resource": map[string]any{
+				"attributes": []any{map[string]any{"key": "service.name", "value": map[string]any{"stringValue": s.service}}},
+			},
+			"scopeSpans": []any{map[string]any{
+				"spans": []any{map[string]any{
+					"traceId":           "0102030405060708090a0b0c0d0e0f10",
+					"spanId":            spanID(s.id),
+					"parentSpanId":      spanID(s.parent),
+					"name":              s.name,
+					"kind":              "SPAN_KIND_SERVER",
+					"startTimeUnixNano": fmt.Sprint(testStart.Add(time.Duration(s.start) * time.Millisecond).UnixNano()),
+					"endTimeUnixNano":   fmt.Sprint(testStart.Add(time.Duration(s.end) * time.Millisecond).UnixNano()),
+					"attributes":        attributes,
+					"status":            status,
+				}},
+			}},
+		})
+	}
+
+	data, err := json.Marshal(map[string]any{"batches": batches})
+	require.NoError(t, err)
+	trace, err := Parse(data)
+	require.NoError(t, err)
+	return trace
+}
+
+// checkoutSpans is a checkout request with three sequential database queries and a failed render step.
+var checkoutSpans = []testSpan{
+	{id: 1, service: "frontend", name: "GET /checkout", start: 0, end: 100, attributes: map[string]string{"http.method": "GET"}},
+	{id: 2, parent: 1, service: "checkout", name: "process", start: 10, end: 60},
+	{id: 3, parent: 2, service: "db", name: "query", start: 15, end: 25, attributes: map[string]string{"db.table": "carts"}},
+	{id: 4, parent: 2, service: "db", name: "query", start: 30, end: 40, attributes: map[string]string{"db.table": "carts"}},
+	{id: 5, parent: 2, service: "db", name: "query", start: 45, end: 55, attributes: map[string]string{"db.table": "orders"}},
+	{id: 6, parent: 1, service: "frontend", name: "render", start: 70, end: 90, error: "timeout"},
+}
+
+func TestParse(t *testing.T) {
+	data := []byte(`{"trace": {"resourceSpans": [{
+		"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "frontend"}}]},
+		"scopeSpans": [{"spans": [
+			{"traceId": "AQIDBAUGBwgJCgsMDQ4PEA==", "spanId": "AAAAAAAAAAI=", "parentSpanId": "AAAAAAAAAAE=", "name": "child",
+			 "kind": 3, "startTimeUnixNano": 2000, "endTimeUnixNano": "3000", "status": {"code": 2, "message": "failed"},
+			 "attributes": [{"key": "retries", "value": {"intValue": "3"}}]},
+			{"spanId": "0000000000000001", "name": "root", "startTimeUnixNano": "1000", "endTimeUnixNano": "5000"}
+		]}]
+	}]}}`)
+
+	trace, err := Parse(data)
+	require.NoError(t, err)
+	require.Equal(t, "0102030405060708090a0b0c0d0e0f10", trace.TraceID)
+	require.Equal(t, 4*time.Microsecond, trace.Duration())
+
+	require.Len(t, trace.Roots, 1)
+	root := trace.Roots[0]
+	require.Equal(t, "root", root.Name)
+	require.Equal(t, "unspecified", root.Kind)
+	require.Len(t, root.Children, 1)
+
+	child := root.Children[0]
+	require.Equal(t, "0000000000000002", child.SpanID)
+	require.Equal(t, root, child.Parent)
+	require.Equal(t, "frontend", child.Service)
+	require.Equal(t, "client", child.Kind)
+	require.True(t, child.Error)
+	require.Equal(t, "failed", child.StatusMessage)
+	require.Equal(t, map[string]any{"retries": int64(3)}, child.Attributes)
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse([]byte(`{"batches": []}`))
+	require.EqualError(t, err, "the trace has no spans")
+
+	_, err = Parse([]byte(`{"batches": [{"scopeSpans": [{"spans": [{"spanId": "01", "startTimeUnixNano": "x"}]}]}]}`))
+	require.ErrorContains(t, err, "invalid start time of span 01")
+}
+
+func TestParseParentCycle(t *testing.T) {
+	trace := testTrace(t,
+		testSpan{id: 1, parent: 2, service: "a", name: "first", start: 0, end: 50},
+		testSpan{id: 2, parent: 1, service: "b", name: "second", start: 10, end: 40},
+		testSpan{id: 3, parent: 2, service: "c", name: "child", start: 20, end: 30},
+		testSpan{id: 4, parent: 4, service: "d", name: "self", start: 60, end: 70},
+	)
+
+	require.Len(t, trace.Roots, 2)
+	require.Equal(t, spanID(1), trace.Roots[0].SpanID)
+	require.Equal(t, spanID(4), trace.Roots[1].SpanID)
+	for _, span := range trace.Spans {
+		depth := 0
+		for s := span; s.Parent != nil; s = s.Parent {
+			depth++
+			require.Less(t, depth, len(trace.Spans), "parent cycle of span %s", span.SpanID)
+		}
+	}
+
+	summary := trace.Summarize(SummaryOptions{MaxDepth: 10, MaxSpans: 20, TopAttributes: 5, MaxErrors: 5})
+	require.Len(t, summary.Hierarchy, 4)
+	var path []string
+	for _, segment := range trace.CriticalPath() {
+		path = append(path, fmt.Sprintf("%s %dms", segment.Span.Name, segment.Duration().Milliseconds()))
+	}
+	require.Equal(t, []string{"first 10ms", "second 10ms", "child 10ms", "second 10ms", "first 10ms"}, path)
+
+	diff := Compare(trace, testTrace(t, checkoutSpans...), 10)
+	require.Len(t, diff.Structure, 8)
+}
@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	collectortracev1 "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector is an OTLP/HTTP receiver which records the exported spans.
+type collector struct {
+	mu    sync.Mutex
+	paths []string
+	spans map[string]*tracev1.Span
+	attrs map[string]string
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request := &collectortracev1.ExportTraceServiceRequest{}
+	if err := proto.Unmarshal(body, request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paths = append(c.paths, r.URL.Path)
+	for _, resourceSpans := range request.ResourceSpans {
+		for _, attr := range resourceSpans.Resource.Attributes {
+			c.attrs[attr.Key] = attr.Value.GetStringValue()
+		}
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				c.spans[span.Name] = span
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	data, _ := proto.Marshal(&collectortracev1.ExportTraceServiceResponse{})
+	_, _ = w.Write(data)
+}
+
+func TestSetup(t *testing.T) {
+	c := &collector{spans: map[string]*tracev1.Span{}, attrs: map[string]string{}}
+	otlpServer := httptest.NewServer(c)
+	defer otlpServer.Close()
+
+	var traceparent string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer downstream.Close()
+
+	ctx := context.Background()
+	shutdown, err := Setup(ctx, Config{Endpoint: otlpServer.URL, SampleRatio: 1, ServiceName: "tempo-mcp-gateway", ServiceVersion: "1.0.0"})
+	require.NoError(t, err)
+
+	// Tracer delegates to the first installed provider, which is shut down if the test runs again
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "tools/call traceql-search")
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, downstream.URL, nil)
+	require.NoError(t, err)
+	httpClient := &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+	response, err := httpClient.Do(request)
+	require.NoError(t, err)
+	require.NoError(t, response.Body.Close())
+	EndSpan(span, errors.New("query failed"))
+
+	require.NoError(t, shutdown(ctx))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	require.Equal(t, []string{defaultTracesPath}, c.paths)
+	require.Equal(t, "tempo-mcp-gateway", c.attrs["service.name"])
+	require.Equal(t, "1.0.0", c.attrs["service.version"])
+	require.Len(t, c.spans, 2)
+
+	toolSpan := c.spans["tools/call traceql-search"]
+	require.NotNil(t, toolSpan)
+	require.Equal(t, tracev1.Status_STATUS_CODE_ERROR, toolSpan.Status.Code)
+	require.Equal(t, "query failed", toolSpan.Status.Message)
+	require.Equal(t, span.SpanContext().SpanID().String(), trace.SpanID(toolSpan.SpanId).String())
+
+	// The downstream request is a child span, and its context is sent in the traceparent header
+	httpSpan := c.spans["HTTP GET"]
+	require.NotNil(t, httpSpan)
+	require.Equal(t, toolSpan.SpanId, httpSpan.ParentSpanId)
+	require.Equal(t, toolSpan.TraceId, httpSpan.TraceId)
+	require.Equal(t, "00-"+trace.TraceID(httpSpan.TraceId).String()+"-"+trace.SpanID(httpSpan.SpanId).String()+"-01", traceparent)
+}
@@ -0,0 +1,351 @@
+package truncation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Config limits the size of tool results. Results which exceed the limit are truncated structurally.
+type Config struct {
+	// Maximum size of a tool result in bytes. Unlimited if zero.
+	MaxBytes int `json:"maxBytes,omitempty"`
+	// Maximum result size of specific tools, replacing the default. Zero disables the limit of a tool.
+	Tools map[string]int `json:"tools,omitempty"`
+}
+
+// hints tell the caller how to fetch the omitted data.
+var hints = map[string]string{
+	"get-trace":               `fetch specific spans of the trace with traceql-search, e.g. { trace:id = "<trace ID>" && span.http.status_code >= 500 }`,
+	"traceql-search":          "lower the limit, add conditions to the query or shorten the time range",
+	"traceql-metrics-range":   "add conditions to the query, group by fewer attributes or shorten the time range",
+	"traceql-metrics-instant": "add conditions to the query or group by fewer attributes",
+}
+
+const defaultHint = "narrow the request, e.g. add conditions to the query or shorten the time range"
+
+// spanDetails are the fields of a span which are dropped first.
+var spanDetails = []string{"events", "links", "attributes"}
+
+// Truncation describes what was omitted from a result.
+type Truncation struct {
+	OriginalBytes int
+	Bytes         int
+	Omitted       []string
+	Hint          string
+}
+
+// Note returns a note for the caller.
+func (t *Truncation) Note() string {
+	return fmt.Sprintf("the result was truncated from %d to %d bytes: %s. To fetch the omitted data, %s",
+		t.OriginalBytes, t.Bytes, strings.Join(t.Omitted, ", "), t.Hint)
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	if c.MaxBytes < 0 {
+		errs = append(errs, fmt.Errorf("maxBytes: must not be negative"))
+	}
+	for _, tool := range slices.Sorted(maps.Keys(c.Tools)) {
+		if c.Tools[tool] < 0 {
+			errs = append(errs, fmt.Errorf("tools[%s]: must not be negative", tool))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c Config) limit(tool string) int {
+	if limit, ok := c.Tools[tool]; ok {
+		return limit
+	}
+	return c.MaxBytes
+}
+
+// Truncate reduces the result of a tool to the size limit of the tool, in place.
+// The structured content is dropped first, because the text content contains the same data.
+// JSON text is truncated structurally: span attributes, events and links are dropped first, then repeated spans are collapsed,
+// then the largest arrays are shortened. Other text is cut.
+// JSON text stays valid JSON, therefore the result can exceed the limit if a single value is too large.
+// Returns nil if the result was not truncated.
+func (c Config) Truncate(result *mcp.CallToolResult, tool string) *Truncation {
+	limit := c.limit(tool)
+	if result == nil || limit <= 0 {
+		return nil
+	}
+
+	size := resultSize(result)
+	if size <= limit {
+		return nil
+	}
+
+	t := &Truncation{OriginalBytes: size, Hint: defaultHint}
+	if hint, ok := hints[tool]; ok {
+		t.Hint = hint
+	}
+
+	if result.StructuredContent != nil {
+		result.StructuredContent = nil
+		t.Omitted = append(t.Omitted, "omitted the structured content")
+		size = resultSize(result)
+	}
+
+	// Truncate the largest text content first
+	for size > limit {
+		i := largestText(result)
+		if i < 0 {
+			break
+		}
+		text := result.Content[i].(mcp.TextContent)
+		budget := max(0, len(text.Text)-(size-limit))
+		var omitted []string
+		text.Text, omitted = truncateText(text.Text, budget)
+		result.Content[i] = text
+		t.Omitted = append(t.Omitted, omitted...)
+
+		newSize := resultSize(result)
+		if newSize >= size {
+			break
+		}
+		size = newSize
+	}
+
+	if size > limit {
+		t.Omitted = append(t.Omitted, fmt.Sprintf("the result still exceeds the limit of %d bytes", limit))
+	}
+	t.Bytes = size
+	return t
+}
+
+// resultSize returns the size of the text and structured content.
+func resultSize(result *mcp.CallToolResult) int {
+	size := 0
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			size += len(text.Text)
+		}
+	}
+	if result.StructuredContent != nil {
+		data, _ := json.Marshal(result.StructuredContent)
+		size += len(data)
+	}
+	return size
+}
+
+func largestText(result *mcp.CallToolResult) int {
+	largest := -1
+	largestSize := 0
+	for i, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok && len(text.Text) > largestSize {
+			largest = i
+			largestSize = len(text.Text)
+		}
+	}
+	return largest
+}
+
+// truncateText reduces text to at most limit bytes and returns a description of what was omitted.
+// JSON is never cut, it exceeds the limit if it does not fit after the structural truncation.
+func truncateText(text string, limit int) (string, []string) {
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err == nil {
+		truncated, omitted := truncateJSON(value, limit)
+		return truncated, omitted
+	}
+	return cut(text, limit), []string{fmt.Sprintf("cut the text after %d bytes", limit)}
+}
+
+// truncateJSON truncates a decoded JSON value structurally. Arrays are emptied if required,
+// the result exceeds the limit if the remaining value does not fit.
+func truncateJSON(value any, limit int) (string, []string) {
+	var omitted []string
+
+	for _, field := range spanDetails {
+		if n := dropSpanField(value, field); n > 0 {
+			omitted = append(omitted, fmt.Sprintf("dropped the %s of %d spans", field, n))
+		}
+		if data := encode(value); len(data) <= limit {
+			return data, omitted
+		}
+	}
+
+	if n := collapseRepeatedSpans(value); n > 0 {
+		omitted = append(omitted, fmt.Sprintf("collapsed %d repeated spans (the remaining span has a repeatedSpans count)", n))
+	}
+	data := encode(value)
+
+	removed := map[string]int{}
+	total := map[string]int{}
+	for len(data) > limit {
+		array := largestArray(value, "")
+		if array == nil {
+			break
+		}
+		keep := len(array.items) / 2
+		if _, ok := total[array.key]; !ok {
+			total[array.key] = countItems(value, array.key)
+		}
+		removed[array.key] += len(array.items) - keep
+		array.set(array.items[:keep])
+		data = encode(value)
+	}
+	for _, key := range slices.Sorted(maps.Keys(removed)) {
+		omitted = append(omitted, fmt.Sprintf("omitted %d of %d %s", removed[key], total[key], key))
+	}
+
+	return data, omitted
+}
+
+func isSpan(m map[string]any) bool {
+	_, ok := m["spanId"]
+	if !ok {
+		_, ok = m["spanID"]
+	}
+	return ok
+}
+
+// dropSpanField removes a field from all spans and returns the number of modified spans.
+func dropSpanField(value any, field string) int {
+	n := 0
+	walk(value, func(m map[string]any) {
+		if _, ok := m[field]; ok && isSpan(m) {
+			delete(m, field)
+			n++
+		}
+	})
+	return n
+}
+
+// collapseRepeatedSpans keeps the first of sibling spans with the same name and parent, and returns the number of removed spans.
+func collapseRepeatedSpans(value any) int {
+	n := 0
+	walkArrays(value, func(items []any) []any {
+		type group struct {
+			name   any
+			parent any
+		}
+		first := map[group]map[string]any{}
+		kept := items[:0]
+		for _, item := range items {
+			span, ok := item.(map[string]any)
+			if !ok || !isSpan(span) {
+				kept = append(kept, item)
+				continue
+			}
+			parent := span["parentSpanId"]
+			if parent == nil {
+				parent = span["parentSpanID"]
+			}
+			g := group{name: fmt.Sprint(span["name"]), parent: fmt.Sprint(parent)}
+			if firstSpan, ok := first[g]; ok {
+				count, _ := firstSpan["repeatedSpans"].(int)
+				firstSpan["repeatedSpans"] = count + 1
+				n++
+				continue
+			}
+			first[g] = span
+			kept = append(kept, item)
+		}
+		return kept
+	})
+	return n
+}
+
+func walk(value any, fn func(map[string]any)) {
+	switch v := value.(type) {
+	case map[string]any:
+		fn(v)
+		for _, field := range v {
+			walk(field, fn)
+		}
+	case []any:
+		for _, item := range v {
+			walk(item, fn)
+		}
+	}
+}
+
+// walkArrays replaces every array with the result of fn.
+func walkArrays(value any, fn func([]any) []any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for k, field := range v {
+			v[k] = walkArrays(field, fn)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = walkArrays(item, fn)
+		}
+		return fn(v)
+	}
+	return value
+}
+
+type array struct {
+	key   string
+	items []any
+	set   func([]any)
+}
+
+// largestArray returns the non-empty array with the most items. key is the name of the field of the array.
+func largestArray(value any, key string) *array {
+	var largest *array
+	consider := func(a *array) {
+		if a != nil && len(a.items) > 0 && (largest == nil || len(a.items) > len(largest.items)) {
+			largest = a
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			if items, ok := v[k].([]any); ok {
+				consider(&array{key: k, items: items, set: func(items []any) { v[k] = items }})
+			}
+			consider(largestArray(v[k], k))
+		}
+	case []any:
+		for _, item := range v {
+			consider(largestArray(item, key))
+		}
+	}
+	return largest
+}
+
+// countItems returns the number of items of all arrays in fields with the key.
+func countItems(value any, key string) int {
+	n := 0
+	walk(value, func(m map[string]any) {
+		if items, ok := m[key].([]any); ok {
+			n += len(items)
+		}
+	})
+	return n
+}
+
+func encode(value any) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// cut cuts text after at most limit bytes, without splitting a character.
+func cut(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	for limit > 0 && !utf8.RuneStart(text[limit]) {
+		limit--
+	}
+	return text[:limit]
+}
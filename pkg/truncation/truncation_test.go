@@ -0,0 +1,136 @@
+package truncation
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+func span(id string, name string, attributes int) map[string]any {
+	attrs := []any{}
+	for i := range attributes {
+		attrs = append(attrs, map[string]any{"key": fmt.Sprintf("attribute%d", i), "value": strings.Repeat("x", 20)})
+	}
+	return map[string]any{
+		"spanId":       id,
+		"parentSpanId": "root",
+		"name":         name,
+		"attributes":   attrs,
+		"events":       []any{map[string]any{"name": "event"}},
+	}
+}
+
+func trace(spans ...map[string]any) string {
+	items := []any{}
+	for _, s := range spans {
+		items = append(items, s)
+	}
+	data, _ := json.Marshal(map[string]any{"spans": items})
+	return string(data)
+}
+
+func TestTruncate(t *testing.T) {
+	largeTrace := trace(span("1", "a", 10), span("2", "b", 10), span("3", "b", 10), span("4", "c", 10))
+	manySpans := []map[string]any{}
+	for i := range 50 {
+		manySpans = append(manySpans, span(fmt.Sprint(i), fmt.Sprint(i), 0))
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		limit    int
+		omitted  []string
+		exceeded bool
+	}{
+		{
+			name:  "attributes",
+			text:  largeTrace,
+			limit: 400,
+			omitted: []string{
+				"dropped the events of 4 spans",
+				"dropped the attributes of 4 spans",
+			},
+		},
+		{
+			name:  "repeated spans",
+			text:  largeTrace,
+			limit: 180,
+			omitted: []string{
+				"dropped the events of 4 spans",
+				"dropped the attributes of 4 spans",
+				"collapsed 1 repeated spans (the remaining span has a repeatedSpans count)",
+			},
+		},
+		{
+			name:  "arrays",
+			text:  trace(manySpans...),
+			limit: 1000,
+			omitted: []string{
+				"dropped the events of 50 spans",
+				"dropped the attributes of 50 spans",
+				"omitted 38 of 50 spans",
+			},
+		},
+		{
+			name:  "empty arrays",
+			text:  trace(manySpans...),
+			limit: 15,
+			omitted: []string{
+				"dropped the events of 50 spans",
+				"dropped the attributes of 50 spans",
+				"omitted 50 of 50 spans",
+			},
+		},
+		{
+			name:     "large value",
+			text:     fmt.Sprintf(`{"spans":[],"value":%q}`, strings.Repeat("x", 100)),
+			limit:    50,
+			omitted:  []string{"the result still exceeds the limit of 50 bytes"},
+			exceeded: true,
+		},
+		{
+			name:    "text",
+			text:    strings.Repeat("é", 50),
+			limit:   51,
+			omitted: []string{"cut the text after 51 bytes"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := mcp.NewToolResultText(tc.text)
+			truncation := Config{MaxBytes: tc.limit}.Truncate(result, "other")
+			require.NotNil(t, truncation)
+			require.Equal(t, tc.omitted, truncation.Omitted)
+			require.Equal(t, defaultHint, truncation.Hint)
+
+			text := result.Content[0].(mcp.TextContent).Text
+			require.Equal(t, len(text), truncation.Bytes)
+			require.Equal(t, tc.exceeded, truncation.Bytes > tc.limit)
+			if json.Valid([]byte(tc.text)) {
+				require.True(t, json.Valid([]byte(text)), "invalid JSON: %s", text)
+			}
+		})
+	}
+}
+
+func TestTruncateStructuredContent(t *testing.T) {
+	text := trace(span("1", "a", 1))
+	var structured any
+	require.NoError(t, json.Unmarshal([]byte(text), &structured))
+	result := mcp.NewToolResultStructured(structured, text)
+
+	truncation := Config{MaxBytes: len(text), Tools: map[string]int{"docs-traceql": 0}}.Truncate(result, "get-trace")
+	require.NotNil(t, truncation)
+	require.Nil(t, result.StructuredContent)
+	require.Equal(t, []string{"omitted the structured content"}, truncation.Omitted)
+	require.Equal(t, hints["get-trace"], truncation.Hint)
+
+	require.Nil(t, Config{MaxBytes: 1, Tools: map[string]int{"docs-traceql": 0}}.Truncate(result, "docs-traceql"))
+	require.Nil(t, Config{MaxBytes: len(text)}.Truncate(result, "get-trace"))
+}